@@ -3,11 +3,13 @@ package main
 import (
     "bytes"
     "bufio"
+    "encoding/json"
     "flag"
     "fmt"
     "io/ioutil"
     "log"
     "os"
+    "path/filepath"
     "strings"
 
     "gopkg.in/yaml.v3"
@@ -24,6 +26,7 @@ func main() {
     account := flag.String("account", "", "Alias for -cpanel-user (cPanel account)")
     dest := flag.String("dest", "./backup", "Destination folder for sieve scripts")
     withMaildir := flag.Bool("maildir", false, "Also export Maildir contents for each mailbox")
+    withSOGo := flag.Bool("sogo", false, "Also export filters in SOGo's format (sogo-filters.json + sogo-extra.sieve)")
     path := flag.String("path", "", "Convert a single filter.yaml or filter file")
     cpUser := flag.String("cpanel-user", "", "Export filters for a cPanel account (domains + mailboxes)")
 
@@ -32,9 +35,21 @@ func main() {
     importMaildir := flag.Bool("import-maildir", false, "Import Maildir messages from a backup using doveadm")
     backupRoot := flag.String("backup", "", "Backup root for -import-sieve (e.g. ./backup/myipgr)")
     domain := flag.String("domain", "", "Limit -import-sieve to a specific domain (optional)")
+    importSOGo := flag.Bool("import-sogo", false, "Load sogo-filters.json from a backup into SOGo with sogo-tool")
+    importAliases := flag.Bool("import-aliases", false, "Create forwarders/catch-alls from aliases.json in a backup")
+    aliasesVia := flag.String("aliases-via", "mailcow", "How -import-aliases creates forwarders: mailcow (API aliases) or sieve (redirects via doveadm)")
     mailbox := flag.String("mailbox", "","Limit import to a single mailbox (localpart or full address, e.g. 'chris' or 'chris@myip.gr')")
     configPath := flag.String("config", "", "Path to exim2sieve.conf (optional)")
 
+    // Offline validation
+    lint := flag.Bool("lint", false, "Lint a .sieve file or every .sieve file under a directory (-path) and print JSON findings")
+    force := flag.Bool("force", false, "Export/import scripts even if lint reports errors")
+
+    // Simulation against sample messages
+    simulate := flag.Bool("simulate", false, "Run a .sieve file or mailbox backup dir (-path) against the .eml files given as arguments")
+    envFrom := flag.String("envelope-from", "", "Envelope sender for -simulate (default: Return-Path of each message)")
+    envTo := flag.String("envelope-to", "", "Envelope recipient for -simulate (default: Delivered-To/X-Original-To/To)")
+
     // Mailcow-related flags (mailbox creation via API)
     createMailcow := flag.Bool("create-mailcow-mailboxes", false,
         "Create mailcow mailboxes from a backup tree (uses [mailcow] config)")
@@ -55,13 +70,23 @@ func main() {
     modeSingleFile := (*path != "")
     modeImportSieve := *importSieve
     modeImportMaildir := *importMaildir
+    modeImportAliases := *importAliases
+    modeImportSOGo := *importSOGo
     modeMailcow := *createMailcow
 
     modeMailcowPw := *mailcowPwFromShadow
+    modeLint := *lint
+    modeSimulate := *simulate
+
+    // -lint and -simulate take their target from -path, so they are not a
+    // single-file conversion.
+    if modeLint || modeSimulate {
+        modeSingleFile = false
+    }
 
 
     // If no mode flags are provided, show help and exit.
-    if !modeExportUser && !modeSingleFile && !modeImportSieve && !modeImportMaildir && !modeMailcow && !modeMailcowPw {
+    if !modeExportUser && !modeSingleFile && !modeImportSieve && !modeImportMaildir && !modeImportAliases && !modeImportSOGo && !modeMailcow && !modeMailcowPw && !modeLint && !modeSimulate {
         fmt.Fprintf(os.Stderr, "exim2sieve – convert cPanel Exim filters to Sieve\n\n")
         fmt.Fprintf(os.Stderr, "Usage:\n")
         fmt.Fprintf(os.Stderr, "  %s [flags]\n\n", os.Args[0])
@@ -71,25 +96,40 @@ func main() {
         fmt.Fprintf(os.Stderr, "    (optional: -maildir to also export Maildir contents)\n")
         fmt.Fprintf(os.Stderr, "  -path <file>          Convert a single filter.yaml or filter file\n")
         fmt.Fprintf(os.Stderr, "  -import-sieve         Import Sieve scripts from a backup using doveadm\n")
-        fmt.Fprintf(os.Stderr, "  -import-maildir       Import Maildir messages from a backup using doveadm\n\n")
+        fmt.Fprintf(os.Stderr, "  -import-maildir       Import Maildir messages from a backup using doveadm\n")
+        fmt.Fprintf(os.Stderr, "  -import-aliases       Create forwarders from aliases.json (-aliases-via mailcow|sieve)\n")
+        fmt.Fprintf(os.Stderr, "  -import-sogo          Load SOGo filters (export with -sogo) using sogo-tool\n\n")
         fmt.Fprintf(os.Stderr, "  -create-mailcow-mailboxes   Create mailcow mailboxes from a backup tree (Mailcow API)\n")
-        fmt.Fprintf(os.Stderr, "  -mailcow-passwords-from-shadow  Update Mailcow mailbox.password from cPanel shadow (MySQL)\n\n")
+        fmt.Fprintf(os.Stderr, "  -mailcow-passwords-from-shadow  Update Mailcow mailbox.password from cPanel shadow (MySQL)\n")
+        fmt.Fprintf(os.Stderr, "  -lint -path <file|dir> Validate Sieve scripts offline (JSON findings on stdout)\n")
+        fmt.Fprintf(os.Stderr, "  -simulate -path <script|mailbox dir> msg.eml...  Show where each message would land\n\n")
 
 
         fmt.Fprintf(os.Stderr, "Export example:\n")
         fmt.Fprintf(os.Stderr, "./exim2sieve -cpanel-user myipgr -dest ./backup\n")
         fmt.Fprintf(os.Stderr, "./exim2sieve -cpanel-user myipgr -dest ./backup -maildir\n")
+        fmt.Fprintf(os.Stderr, "./exim2sieve -cpanel-user myipgr -dest ./backup -sogo\n")
         fmt.Fprintf(os.Stderr, "Import example:\n")
         fmt.Fprintf(os.Stderr, "./exim2sieve -config exim2sieve.conf  -import-sieve -backup ./backup/myipgr -domain myip.gr \n")
         fmt.Fprintf(os.Stderr, "./exim2sieve -config exim2sieve.conf  -import-maildir -backup ./backup/myipgr -domain myip.gr\n")
         fmt.Fprintf(os.Stderr, "  (use -mailbox chris or -mailbox chris@myip.gr to limit to a single mailbox)\n")
 
+        fmt.Fprintf(os.Stderr, "./exim2sieve -config exim2sieve.conf  -import-aliases -backup ./backup/myipgr -domain myip.gr\n")
+        fmt.Fprintf(os.Stderr, "./exim2sieve -config exim2sieve.conf  -import-aliases -aliases-via sieve -backup ./backup/myipgr -mailbox chris@myip.gr\n")
+        fmt.Fprintf(os.Stderr, "./exim2sieve -config exim2sieve.conf  -import-sogo -backup ./backup/myipgr -domain myip.gr\n")
+
         fmt.Fprintf(os.Stderr, "Mailcow mailboxes example:\n")
         fmt.Fprintf(os.Stderr, "./exim2sieve -config exim2sieve.conf -create-mailcow-mailboxes -backup ./backup/myipgr -domain myip.gr\n")
 
         fmt.Fprintf(os.Stderr, "Mailcow passwords from shadow example:\n")
         fmt.Fprintf(os.Stderr, "./exim2sieve -config exim2sieve.conf -mailcow-passwords-from-shadow -backup ./backup/myipgr -domain myip.gr\n")
 
+        fmt.Fprintf(os.Stderr, "Lint example:\n")
+        fmt.Fprintf(os.Stderr, "./exim2sieve -lint -path ./backup/myipgr\n")
+
+        fmt.Fprintf(os.Stderr, "Simulate example:\n")
+        fmt.Fprintf(os.Stderr, "./exim2sieve -simulate -path ./backup/myipgr/myip.gr/chris invoice.eml newsletter.eml\n")
+
 
 
         fmt.Fprintf(os.Stderr, "Other flags:\n")
@@ -112,6 +152,12 @@ func main() {
     if modeImportMaildir {
         activeModes++
     }
+    if modeImportAliases {
+        activeModes++
+    }
+    if modeImportSOGo {
+        activeModes++
+    }
 
     if modeMailcow {
         activeModes++
@@ -121,8 +167,36 @@ func main() {
         activeModes++
     }
 
+    if modeLint {
+        activeModes++
+    }
+
+    if modeSimulate {
+        activeModes++
+    }
+
     if activeModes > 1 {
-        log.Fatal("Only one mode can be used at a time (-cpanel-user/-account, -path, -import-sieve, -import-maildir, -create-mailcow-mailboxes, -mailcow-passwords-from-shadow)")
+        log.Fatal("Only one mode can be used at a time (-cpanel-user/-account, -path, -import-sieve, -import-maildir, -import-aliases, -import-sogo, -create-mailcow-mailboxes, -mailcow-passwords-from-shadow, -lint, -simulate)")
+    }
+
+    //  Simulate mode: evaluate a script against sample messages
+    if modeSimulate {
+        if *path == "" || flag.NArg() == 0 {
+            log.Fatal("-simulate needs -path <script or mailbox dir> and at least one message file")
+        }
+        handleSimulate(*path, flag.Args(), *envFrom, *envTo)
+        return
+    }
+
+    //  Lint mode: offline validation of existing or generated scripts
+    if modeLint {
+        if *path == "" {
+            log.Fatal("-path is required with -lint")
+        }
+        if !handleLint(*path) {
+            os.Exit(1)
+        }
+        return
     }
 
     //  Import Sieve mode: use doveadm to load Sieve into Dovecot
@@ -144,6 +218,10 @@ func main() {
             // but we keep the config unified.
             MaildirHostBase:      cfg.MaildirHostBase,
             MaildirContainerBase: cfg.MaildirContainerBase,
+            Force:                *force,
+            Sieve:                sieveOptions(cfg),
+            DomainScripts:        cfg.DomainScripts,
+            GlobalSieveDir:       cfg.GlobalSieveDir,
         }
 
         if err := importer.ImportSieve(ic); err != nil {
@@ -173,6 +251,8 @@ func main() {
             // On non-docker systems leave them empty in the config.
             MaildirHostBase:      cfg.MaildirHostBase,
             MaildirContainerBase: cfg.MaildirContainerBase,
+            // Folder names are reported the way the filters name them.
+            Sieve: sieveOptions(cfg),
         }
 
         if err := importer.ImportMaildir(ic); err != nil {
@@ -182,6 +262,74 @@ func main() {
     }
 
 
+    //  Import aliases mode: forwarders/catch-alls from aliases.json
+    if modeImportAliases {
+        if *backupRoot == "" {
+            log.Fatal("-backup is required with -import-aliases")
+        }
+        cfg, err := config.Load(*configPath)
+        if err != nil {
+            log.Fatalf("Cannot load config: %v", err)
+        }
+
+        switch *aliasesVia {
+        case "mailcow":
+            client, err := mailcow.NewClientFromConfig(cfg)
+            if err != nil {
+                log.Fatalf("mailcow client: %v", err)
+            }
+            if err := mailcow.CreateAliasesFromBackup(client, *backupRoot, *domain, *mailbox, nil); err != nil {
+                log.Fatal(err)
+            }
+        case "sieve":
+            ic := importer.ImportConfig{
+                BackupRoot: *backupRoot,
+                Domain:     *domain,
+                Mailbox:    *mailbox,
+                DoveadmCmd: cfg.DoveadmCmd,
+                Force:      *force,
+                Sieve:      sieveOptions(cfg),
+
+                DomainScripts:  cfg.DomainScripts,
+                GlobalSieveDir: cfg.GlobalSieveDir,
+            }
+            if err := importer.ImportAliasesSieve(ic); err != nil {
+                log.Fatal(err)
+            }
+        default:
+            log.Fatalf("-aliases-via must be mailcow or sieve, got %q", *aliasesVia)
+        }
+        return
+    }
+
+
+    //  Import SOGo filters mode (sogo-tool + doveadm for the extra script)
+    if modeImportSOGo {
+        if *backupRoot == "" {
+            log.Fatal("-backup is required with -import-sogo")
+        }
+        cfg, err := config.Load(*configPath)
+        if err != nil {
+            log.Fatalf("Cannot load config: %v", err)
+        }
+
+        ic := importer.ImportConfig{
+            BackupRoot:  *backupRoot,
+            Domain:      *domain,
+            Mailbox:     *mailbox,
+            DoveadmCmd:  cfg.DoveadmCmd,
+            Force:       *force,
+            SOGoToolCmd: cfg.SOGoToolCmd,
+
+            GlobalSieveDir: cfg.GlobalSieveDir,
+        }
+        if err := importer.ImportSOGo(ic); err != nil {
+            log.Fatal(err)
+        }
+        return
+    }
+
+
     //  Mailcow mailbox creation mode (API only, no sieve import here)
     if modeMailcow {
         if *backupRoot == "" {
@@ -231,7 +379,17 @@ func main() {
         if modeSingleFile {
             log.Fatal("-cpanel-user/-account cannot be combined with -path")
         }
-        if err := cpanel.ExportUser(*cpUser, *dest, *withMaildir); err != nil {
+        cfg, err := config.Load(*configPath)
+        if err != nil {
+            log.Fatalf("Cannot load config: %v", err)
+        }
+        opts := cpanel.ExportOptions{
+            WithMaildir: *withMaildir,
+            Force:       *force,
+            SOGo:        *withSOGo,
+            Sieve:       sieveOptions(cfg),
+        }
+        if err := cpanel.ExportUser(*cpUser, *dest, opts); err != nil {
             log.Fatal(err)
         }
         return
@@ -239,7 +397,11 @@ func main() {
 
     //  Single file mode: demo / standalone
     if modeSingleFile {
-        handleSingleFile(*path, *dest)
+        cfg, err := config.Load(*configPath)
+        if err != nil {
+            log.Fatalf("Cannot load config: %v", err)
+        }
+        handleSingleFile(*path, *dest, sieveOptions(cfg), *force)
         return
     }
 
@@ -247,11 +409,71 @@ func main() {
     log.Fatal("No valid mode selected (this should be unreachable)")
 }
 
-func handleSingleFile(path string, dest string) {
+// sieveOptions builds the conversion options from the [sieve] section.
+func sieveOptions(cfg *config.Config) sieve.Options {
+    profile, err := sieve.ResolveProfile(cfg.SieveProfile, cfg.SieveExtensions, cfg.SieveMaxRedirects)
+    if err != nil {
+        log.Fatalf("Invalid [sieve] config: %v", err)
+    }
+    switch cfg.DisabledFilters {
+    case "", sieve.DisabledComment, sieve.DisabledRoundcube:
+    default:
+        log.Fatalf("Invalid [sieve] config: disabled_filters must be %s or %s", sieve.DisabledComment, sieve.DisabledRoundcube)
+    }
+    switch cfg.SieveDialect {
+    case "", sieve.DialectPlain, sieve.DialectRoundcube:
+    default:
+        log.Fatalf("Invalid [sieve] config: dialect must be %s or %s", sieve.DialectPlain, sieve.DialectRoundcube)
+    }
+    switch cfg.AnyRecipient {
+    case "", sieve.RecipientHeaders, sieve.RecipientEnvelope:
+    default:
+        log.Fatalf("Invalid [sieve] config: any_recipient must be %s or %s", sieve.RecipientHeaders, sieve.RecipientEnvelope)
+    }
+    spamHeaders := map[string]sieve.SpamRewrite{}
+    for from, to := range cfg.SpamHeaders {
+        w, err := sieve.ParseSpamRewrite(to)
+        if err != nil {
+            log.Fatalf("Invalid [spam_headers] config: %s: %v", from, err)
+        }
+        spamHeaders[strings.ToLower(from)] = w
+    }
+    return sieve.Options{
+        Profile:          profile,
+        PipeCommands:     cfg.PipeMap,
+        QuarantineFolder: cfg.QuarantineFolder,
+        DisabledFilters:  cfg.DisabledFilters,
+        Dialect:          cfg.SieveDialect,
+        FolderSeparator:  cfg.FolderSeparator,
+        FolderMap:        cfg.FolderMap,
+        AnyRecipient:     cfg.AnyRecipient,
+        SpamHeaders:      spamHeaders,
+    }
+}
+
+// writeSingleReport prints the conversion report and saves it in dest.
+func writeSingleReport(report *sieve.Report, dest string) {
+    if len(report.Items) == 0 {
+        return
+    }
+    for _, it := range report.Items {
+        log.Printf("REPORT %s", it)
+    }
+    path := filepath.Join(dest, "conversion-report.json")
+    if err := report.WriteJSON(path); err != nil {
+        log.Fatalf("Cannot write conversion report: %v\n", err)
+    }
+    fmt.Printf("Conversion report (%d items, profile %s) in %s\n", len(report.Items), report.Profile, path)
+}
+
+func handleSingleFile(path string, dest string, opts sieve.Options, force bool) {
     data, err := ioutil.ReadFile(path)
     if err != nil {
         log.Fatalf("Cannot read file: %v\n", err)
     }
+    if err := os.MkdirAll(dest, 0755); err != nil {
+        log.Fatalf("Cannot create %s: %v\n", dest, err)
+    }
 
     // Decide if this is YAML (filter.yaml) or text Exim filter ("filter")
     if isYAML(data) {
@@ -259,13 +481,16 @@ func handleSingleFile(path string, dest string) {
         if err := yaml.Unmarshal(data, &f); err != nil {
             log.Fatalf("YAML parse error: %v\n", err)
         }
-        scripts := sieve.ConvertFilters(f)
+        scripts, report := sieve.ConvertFilters(f, opts)
         if len(scripts) == 0 {
             log.Println("No enabled filters in YAML, nothing to export.")
             return
         }
         combined := sieve.CombineScripts("filters", scripts)
+        combined = sieve.ApplyDialect(combined, opts, report)
 
+        writeSingleReport(report, dest)
+        lintSingle(combined, force)
         if err := sieve.WriteScripts([]sieve.SieveScript{combined}, dest); err != nil {
             log.Fatalf("Cannot write sieve scripts: %v\n", err)
         }
@@ -278,12 +503,12 @@ func handleSingleFile(path string, dest string) {
     }
 
     // Text Exim filter mode
-    f, err := cpanel.ParseFilterFile(path)
+    f, diags, err := cpanel.ParseFilterFile(path)
     if err != nil {
         log.Fatalf("Cannot parse Exim filter: %v\n", err)
     }
 
-    scripts := sieve.ConvertFilters(f)
+    scripts, report := sieve.ConvertFilters(f, opts)
     if len(scripts) == 0 {
         log.Println("No enabled filters, nothing to export.")
         return
@@ -291,7 +516,13 @@ func handleSingleFile(path string, dest string) {
 
     // Single-file mode: also produce one combined filters.sieve
     combined := sieve.CombineScripts("filters", scripts)
+    combined = sieve.ApplyDialect(combined, opts, report)
 
+    writeSingleReport(report, dest)
+    if err := cpanel.WriteWarnings(diags, path, filepath.Join(dest, "conversion-warnings.json")); err != nil {
+        log.Fatalf("Cannot write conversion warnings: %v\n", err)
+    }
+    lintSingle(combined, force)
     if err := sieve.WriteScripts([]sieve.SieveScript{combined}, dest); err != nil {
         log.Fatalf("Cannot write sieve scripts: %v\n", err)
     }
@@ -302,6 +533,143 @@ func handleSingleFile(path string, dest string) {
     )
 }
 
+// lintSingle lints the script of single-file mode and exits before it is
+// written if there are errors, unless -force is given.
+func lintSingle(sc sieve.SieveScript, force bool) {
+    findings := sieve.Lint(sc)
+    for _, f := range findings {
+        log.Printf("LINT %s", f)
+    }
+    if sieve.HasErrors(findings) && !force {
+        log.Fatalf("Generated Sieve has lint errors; %s.sieve not written (use -force to export anyway)\n", sc.Name)
+    }
+}
+
+// handleLint lints a single .sieve file, or every .sieve file under a
+// directory, and prints the findings as a JSON array on stdout.
+// Returns false if any finding is an error.
+func handleLint(path string) bool {
+    var files []string
+    err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        if !info.IsDir() && (p == path || strings.HasSuffix(p, ".sieve")) {
+            files = append(files, p)
+        }
+        return nil
+    })
+    if err != nil {
+        log.Fatalf("Cannot read %s: %v\n", path, err)
+    }
+
+    findings := []sieve.Finding{}
+    for _, file := range files {
+        data, err := ioutil.ReadFile(file)
+        if err != nil {
+            log.Fatalf("Cannot read file: %v\n", err)
+        }
+        findings = append(findings, sieve.Lint(sieve.SieveScript{Name: file, Content: string(data)})...)
+    }
+
+    out, err := json.MarshalIndent(findings, "", "  ")
+    if err != nil {
+        log.Fatalf("Cannot encode findings: %v\n", err)
+    }
+    fmt.Println(string(out))
+
+    log.Printf("Linted %d scripts: %d findings", len(files), len(findings))
+    return !sieve.HasErrors(findings)
+}
+
+// handleSimulate runs a script (or the script of a mailbox directory from
+// the backup tree) against each message and prints the resulting actions.
+func handleSimulate(target string, messages []string, envFrom, envTo string) {
+    var sc sieve.SieveScript
+    var err error
+    if fi, statErr := os.Stat(target); statErr == nil && fi.IsDir() {
+        sc, err = mailboxScript(target)
+    } else {
+        sc, err = sieve.ReadScript(target)
+    }
+    if err != nil {
+        log.Fatalf("Cannot load script: %v\n", err)
+    }
+
+    for _, file := range messages {
+        msg, err := sieve.ReadMessage(file)
+        if err != nil {
+            log.Fatalf("Cannot read message %s: %v\n", file, err)
+        }
+        if envFrom != "" {
+            msg.EnvelopeFrom = envFrom
+        }
+        if envTo != "" {
+            msg.EnvelopeTo = envTo
+        }
+
+        res := sieve.Simulate(sc.Script, msg)
+
+        fmt.Printf("%s (envelope from=%q to=%q):\n", file, msg.EnvelopeFrom, msg.EnvelopeTo)
+        for _, a := range res.Actions {
+            fmt.Printf("    %s\n", a)
+        }
+        if res.ImplicitKeep {
+            fmt.Printf("    keep (implicit)\n")
+        }
+        for _, n := range res.Notes {
+            fmt.Printf("    note: %s\n", n)
+        }
+    }
+}
+
+// mailboxScript assembles what -import-sieve uploads for a mailbox dir of
+// the backup tree: the domain rules (../_domain.sieve) in front of the
+// mailbox's own script, as Exim runs them.
+func mailboxScript(dir string) (sieve.SieveScript, error) {
+    var scripts []sieve.SieveScript
+    var paths []string
+    domainPath := filepath.Join(filepath.Dir(dir), "_domain.sieve")
+    if _, err := os.Stat(domainPath); err == nil {
+        paths = append(paths, domainPath)
+    }
+    if own := findMailboxScript(dir); own != "" {
+        paths = append(paths, own)
+    }
+    if len(paths) == 0 {
+        return sieve.SieveScript{}, fmt.Errorf("no .sieve file found in %s", dir)
+    }
+    for _, p := range paths {
+        sc, err := sieve.ReadScript(p)
+        if err != nil {
+            return sieve.SieveScript{}, err
+        }
+        scripts = append(scripts, sc)
+    }
+    log.Printf("INFO: simulating %s", strings.Join(paths, " + "))
+    if len(scripts) == 1 {
+        return scripts[0], nil
+    }
+    return sieve.CombineScripts("cpanel-migrated", scripts), nil
+}
+
+// findMailboxScript picks the script of a mailbox dir from the backup tree:
+// <dir>/<name>.sieve if present, otherwise the first *.sieve file other
+// than sogo-extra.sieve, which only runs after SOGo's filters.
+func findMailboxScript(dir string) string {
+    preferred := filepath.Join(dir, filepath.Base(dir)+".sieve")
+    if _, err := os.Stat(preferred); err == nil {
+        return preferred
+    }
+    matches, _ := filepath.Glob(filepath.Join(dir, "*.sieve"))
+    for _, m := range matches {
+        if filepath.Base(m) != importer.SOGoExtraHook {
+            return m
+        }
+    }
+    return ""
+}
+
 // isYAML does a cheap detection whether the file looks like a cPanel YAML filter
 // (filter.yaml) instead of a plain Exim text filter ("filter").
 func isYAML(data []byte) bool {
@@ -13,6 +13,9 @@ type Config struct {
 
     DoveadmCmd []string // e.g. {"doveadm"} or {"docker", "exec", "-i", "...", "doveadm"}
 
+    // SOGoToolCmd is how sogo-tool is run ([sogo] command), like DoveadmCmd.
+    SOGoToolCmd []string
+
     // Mailcow API integration (optional, used by mailcow-related modes)
     MailcowAPIURL  string
     MailcowAPIKey  string
@@ -32,6 +35,36 @@ type Config struct {
     MaildirHostBase      string
     MaildirContainerBase string
 
+    // Target Sieve implementation ([sieve] section). The profile name is
+    // resolved by sieve.ResolveProfile; SieveExtensions adjusts it with
+    // "+ext" / "-ext" entries, or replaces its list with plain names.
+    SieveProfile      string
+    SieveExtensions   []string
+    SieveMaxRedirects int
+    QuarantineFolder  string // where Exim "freeze" files messages
+    DisabledFilters   string // comment (default) or roundcube
+    SieveDialect      string // output dialect: plain (default) or roundcube
+    FolderSeparator   string // hierarchy separator of the target namespace
+    AnyRecipient      string // "any recipient" tests: headers (default) or envelope
+
+    // FolderMap ([folders] section) renames cPanel folders in save paths,
+    // e.g. "INBOX.Sent" -> "Sent". Keys keep their case.
+    FolderMap map[string]string
+
+    // SpamHeaders ([spam_headers] section) moves conditions on SpamAssassin
+    // headers to the target's, e.g. "X-Spam-Bar" -> "X-Spamd-Bar". Values
+    // are parsed by sieve.ParseSpamRewrite.
+    SpamHeaders map[string]string
+
+    // How -import-sieve deploys _domain.sieve: inline (default), include,
+    // before or skip. GlobalSieveDir is the host directory that include and
+    // before write <domain>.sieve to (sieve_global / sieve_before).
+    DomainScripts  string
+    GlobalSieveDir string
+
+    // PipeMap ([pipe] section) maps Exim pipe commands to the program
+    // names allowed by the target's sieve_pipe_bin_dir. Keys keep their case.
+    PipeMap map[string]string
 }
 
 // Load tries an explicit path (if given), then ./exim2sieve.conf, then
@@ -70,6 +103,7 @@ func Load(path string) (*Config, error) {
     // Fallback: assume plain "doveadm" in PATH.
     return &Config{
         DoveadmCmd:         []string{"doveadm"},
+        SOGoToolCmd:        []string{"sogo-tool"},
         MailcowQuotaMB:     5120, // 5GB default
         MaildirHostBase:      "",
         MaildirContainerBase: "",
@@ -93,6 +127,7 @@ func loadFrom(path string) (*Config, error) {
     scanner := bufio.NewScanner(f)
     cfg := &Config{
         DoveadmCmd:         []string{"doveadm"},
+        SOGoToolCmd:        []string{"sogo-tool"},
         MailcowQuotaMB:     5120, // sensible default
         MaildirHostBase:      "",
         MaildirContainerBase: "",
@@ -121,12 +156,23 @@ func loadFrom(path string) (*Config, error) {
 
 
         // key = value
-        idx := strings.Index(line, "=")
-        if idx == -1 {
-            continue
+        var rawKey, val string
+        switch currentSection {
+        case "pipe", "folders", "spam_headers":
+            // The key is a command or name that may contain "=" itself.
+            var ok bool
+            if rawKey, val, ok = splitMapEntry(line); !ok {
+                continue
+            }
+        default:
+            idx := strings.Index(line, "=")
+            if idx == -1 {
+                continue
+            }
+            rawKey = strings.TrimSpace(line[:idx])
+            val = strings.TrimSpace(line[idx+1:])
         }
-        key := strings.ToLower(strings.TrimSpace(line[:idx]))
-        val := strings.TrimSpace(line[idx+1:])
+        key := strings.ToLower(rawKey)
 
         switch currentSection {
         case "doveadm":
@@ -136,6 +182,10 @@ func loadFrom(path string) (*Config, error) {
                     cfg.DoveadmCmd = parts
                 }
             }
+        case "sogo":
+            if key == "command" && val != "" {
+                cfg.SOGoToolCmd = strings.Fields(val)
+            }
         case "mailcow":
             switch key {
             case "api_url":
@@ -169,6 +219,49 @@ func loadFrom(path string) (*Config, error) {
 
 
             }
+        case "pipe":
+            // /home/user/bin/ticket.php = ticket
+            if cfg.PipeMap == nil {
+                cfg.PipeMap = map[string]string{}
+            }
+            cfg.PipeMap[rawKey] = val
+        case "sieve":
+            switch key {
+            case "profile":
+                cfg.SieveProfile = val
+            case "extensions":
+                cfg.SieveExtensions = splitList(val)
+            case "quarantine_folder":
+                cfg.QuarantineFolder = val
+            case "max_redirects":
+                if n, err := strconv.Atoi(val); err == nil {
+                    cfg.SieveMaxRedirects = n
+                }
+            case "dialect":
+                cfg.SieveDialect = strings.ToLower(val)
+            case "disabled_filters":
+                cfg.DisabledFilters = strings.ToLower(val)
+            case "domain_scripts":
+                cfg.DomainScripts = strings.ToLower(val)
+            case "global_dir":
+                cfg.GlobalSieveDir = strings.TrimRight(val, "/")
+            case "folder_separator":
+                cfg.FolderSeparator = val
+            case "any_recipient":
+                cfg.AnyRecipient = strings.ToLower(val)
+            }
+        case "folders":
+            // INBOX.Sent = Sent
+            if cfg.FolderMap == nil {
+                cfg.FolderMap = map[string]string{}
+            }
+            cfg.FolderMap[rawKey] = val
+        case "spam_headers":
+            // X-Spam-Score = X-Rspamd-Score * 1.2
+            if cfg.SpamHeaders == nil {
+                cfg.SpamHeaders = map[string]string{}
+            }
+            cfg.SpamHeaders[rawKey] = val
         case "paths":
             switch key {
             case "maildir_host_base":
@@ -191,6 +284,40 @@ func loadFrom(path string) (*Config, error) {
     return cfg, nil
 }
 
+// splitMapEntry splits a line of a map section ([pipe], [folders],
+// [spam_headers]), whose keys may contain "=":
+//   "php -d memory_limit=256M /home/u/t.php" = ticket   (quoted key)
+//   php -d memory_limit=256M /home/u/t.php = ticket     (last " = ")
+//   INBOX.Sent=Sent                                     (first "=")
+func splitMapEntry(line string) (key, val string, ok bool) {
+    if strings.HasPrefix(line, `"`) {
+        if end := strings.Index(line[1:], `"`); end >= 0 {
+            rest := strings.TrimSpace(line[end+2:])
+            if strings.HasPrefix(rest, "=") {
+                return line[1 : end+1], strings.TrimSpace(rest[1:]), true
+            }
+        }
+    }
+    idx := strings.LastIndex(line, " = ")
+    if idx == -1 {
+        idx = strings.Index(line, "=")
+    }
+    if idx == -1 {
+        return "", "", false
+    }
+    if line[idx] == ' ' {
+        return strings.TrimSpace(line[:idx]), strings.TrimSpace(line[idx+3:]), true
+    }
+    return strings.TrimSpace(line[:idx]), strings.TrimSpace(line[idx+1:]), true
+}
+
+// splitList splits a comma and/or whitespace separated value.
+func splitList(val string) []string {
+    return strings.FieldsFunc(val, func(r rune) bool {
+        return r == ',' || r == ' ' || r == '\t'
+    })
+}
+
 // parseQuotaMB parses things like:
 //   "3072", "5GB", "10G", "500MB", "500M"
 // and returns MB (which is what mailcow wants for quota).
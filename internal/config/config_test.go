@@ -0,0 +1,46 @@
+package config
+
+import (
+    "os"
+    "path/filepath"
+    "reflect"
+    "testing"
+)
+
+func TestMapSectionKeys(t *testing.T) {
+    src := `[mailcow]
+api_key = abc=def = x
+
+[pipe]
+/home/u/bin/ticket.php = ticket
+php -d memory_limit=256M /home/u/t.php = ticket
+"/usr/bin/x --opt = 1" = x
+
+[folders]
+INBOX.Sent=Sent Items
+`
+    path := filepath.Join(t.TempDir(), "t.conf")
+    if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+        t.Fatal(err)
+    }
+    cfg, err := loadFrom(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    wantPipe := map[string]string{
+        "/home/u/bin/ticket.php":                 "ticket",
+        "php -d memory_limit=256M /home/u/t.php": "ticket",
+        "/usr/bin/x --opt = 1":                   "x",
+    }
+    if !reflect.DeepEqual(cfg.PipeMap, wantPipe) {
+        t.Errorf("PipeMap = %q, want %q", cfg.PipeMap, wantPipe)
+    }
+    if got := cfg.FolderMap["INBOX.Sent"]; got != "Sent Items" {
+        t.Errorf("FolderMap = %q", cfg.FolderMap)
+    }
+    // Other sections keep splitting at the first "=".
+    if cfg.MailcowAPIKey != "abc=def = x" {
+        t.Errorf("api_key = %q", cfg.MailcowAPIKey)
+    }
+}
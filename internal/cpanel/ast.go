@@ -0,0 +1,188 @@
+package cpanel
+
+import (
+    "strings"
+)
+
+// Pos is a 1-based line/column position inside an Exim filter file.
+type Pos struct {
+    Line   int
+    Column int
+}
+
+// File is a parsed Exim filter: its top-level commands in order.
+type File struct {
+    Commands []Command
+}
+
+// Command is a statement of an Exim filter: *If or *Action.
+type Command interface {
+    Position() Pos
+}
+
+// If is an if/elif/else/endif statement. Branches holds the if and each
+// elif in order; Else is nil when there is no else part.
+type If struct {
+    Branches []Branch
+    Else     []Command
+    Comments []string // hash comments before the if ("#Name" in cPanel filters)
+    Pos      Pos
+}
+
+// Branch is one condition of an if/elif with the commands it guards.
+type Branch struct {
+    Cond Cond
+    Body []Command
+}
+
+// Action is a filter command such as deliver, save, pipe, fail or finish.
+//
+// Arg is its main argument (address, path, command, header text);
+// keyword options such as "text", "errors_to" or the mail/vacation
+// options ("subject", "once", ...) are kept in Options.
+type Action struct {
+    Name     string
+    Arg      string
+    Options  map[string]string
+    Seen     bool // "seen" prefix
+    Unseen   bool // "unseen" prefix
+    Noerror  bool // "noerror" prefix
+    Comments []string
+    Pos      Pos
+}
+
+func (c *If) Position() Pos     { return c.Pos }
+func (c *Action) Position() Pos { return c.Pos }
+
+// Cond is a condition: *Compare, *Logic, *Not, *ForAnyAddress or *Test.
+type Cond interface {
+    Position() Pos
+    String() string
+}
+
+// Compare is "<left> [does not] contains|is|begins|ends|matches <right>",
+// or the numeric "is [not] above|below". Op is the verb in its singular,
+// lower-case form (contains, is, begins, ends, matches, above, below);
+// CaseSensitive is set for Exim's capitalised verbs (Contains, Is, ...).
+type Compare struct {
+    Left          string
+    Op            string
+    Negated       bool
+    CaseSensitive bool
+    Right         string
+    Pos           Pos
+}
+
+// Logic is an "and" / "or" over two or more conditions.
+type Logic struct {
+    Op    string // and, or
+    Terms []Cond
+    Pos   Pos
+}
+
+// Not negates a condition.
+type Not struct {
+    Cond Cond
+    Pos  Pos
+}
+
+// ForAnyAddress is "foranyaddress <list> (<cond>)": cond is tested with
+// $thisaddress set to each address of the list.
+type ForAnyAddress struct {
+    List string
+    Cond Cond
+    Pos  Pos
+}
+
+// Test is one of Exim's condition keywords: delivered, error_message,
+// first_delivery, manually_thawed or personal (with its Args).
+type Test struct {
+    Name string
+    Args []string
+    Pos  Pos
+}
+
+func (c *Compare) Position() Pos       { return c.Pos }
+func (c *Logic) Position() Pos         { return c.Pos }
+func (c *Not) Position() Pos           { return c.Pos }
+func (c *ForAnyAddress) Position() Pos { return c.Pos }
+func (c *Test) Position() Pos          { return c.Pos }
+
+// singularVerbs are the forms of Compare.Op used after "does not".
+var singularVerbs = map[string]string{
+    "contains": "contain",
+    "begins":   "begin",
+    "ends":     "end",
+    "matches":  "match",
+}
+
+func (c *Compare) String() string {
+    word := c.Op
+    switch {
+    case c.Op == "above" || c.Op == "below":
+        word = "is"
+    case c.Negated && c.Op != "is":
+        word = singularVerbs[c.Op]
+    }
+    if c.CaseSensitive {
+        word = strings.ToUpper(word[:1]) + word[1:]
+    }
+
+    verb := word
+    switch {
+    case c.Op == "above" || c.Op == "below":
+        verb = word + " " + c.Op
+        if c.Negated {
+            verb = word + " not " + c.Op
+        }
+    case c.Negated && c.Op == "is":
+        verb = word + " not"
+    case c.Negated:
+        verb = "does not " + word
+    }
+    return quoteExim(c.Left) + " " + verb + " " + quoteExim(c.Right)
+}
+
+func (c *Logic) String() string {
+    parts := make([]string, 0, len(c.Terms))
+    for _, t := range c.Terms {
+        s := t.String()
+        if _, ok := t.(*Logic); ok {
+            s = "(" + s + ")"
+        }
+        parts = append(parts, s)
+    }
+    return strings.Join(parts, " "+c.Op+" ")
+}
+
+func (c *Not) String() string {
+    if _, ok := c.Cond.(*Logic); ok {
+        return "not (" + c.Cond.String() + ")"
+    }
+    return "not " + c.Cond.String()
+}
+
+func (c *ForAnyAddress) String() string {
+    return "foranyaddress " + quoteExim(c.List) + " (" + c.Cond.String() + ")"
+}
+
+func (c *Test) String() string {
+    if len(c.Args) == 0 {
+        return c.Name
+    }
+    args := make([]string, 0, len(c.Args))
+    for _, a := range c.Args {
+        args = append(args, quoteExim(a))
+    }
+    return c.Name + " " + strings.Join(args, " ")
+}
+
+// quoteExim writes s as an Exim string: bare when it is a single word,
+// quoted otherwise.
+func quoteExim(s string) string {
+    if s != "" && !strings.ContainsAny(s, " \t\r\n\"\\()#") {
+        return s
+    }
+    r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+    return `"` + r.Replace(s) + `"`
+}
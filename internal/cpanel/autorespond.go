@@ -0,0 +1,216 @@
+package cpanel
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "log"
+    "mime"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+    "unicode/utf8"
+
+    "exim2sieve/internal/sieve"
+)
+
+// autoresponderFiles returns the cPanel autoresponder files of an address:
+// ~/.autorespond/<address> (the message) and its .json or .conf settings.
+// msg is "" when the address has no autoresponder.
+func autoresponderFiles(homeDir, address string) (msg, settings string) {
+    dir := filepath.Join(homeDir, ".autorespond")
+    msg = filepath.Join(dir, address)
+    if !fileExists(msg) {
+        return "", ""
+    }
+    for _, ext := range []string{".json", ".conf"} {
+        if p := msg + ext; fileExists(p) {
+            return msg, p
+        }
+    }
+    return msg, ""
+}
+
+// autoresponderAddresses lists the addresses that have a message file in
+// ~/.autorespond, sorted.
+func autoresponderAddresses(homeDir string) []string {
+    entries, err := os.ReadDir(filepath.Join(homeDir, ".autorespond"))
+    if err != nil {
+        return nil
+    }
+    var out []string
+    for _, e := range entries {
+        name := e.Name()
+        ext := filepath.Ext(name)
+        if e.IsDir() || ext == ".json" || ext == ".conf" || !strings.Contains(name, "@") {
+            continue
+        }
+        out = append(out, name)
+    }
+    sort.Strings(out)
+    return out
+}
+
+// exportOrphanAutoresponder keeps the autoresponder of an address without a
+// mailbox (a forwarder, usually) in <domain>/_autorespond/: the raw files
+// and the converted script, for the admin to attach where the mail ends up.
+func exportOrphanAutoresponder(homeDir, userOutDir, address string, opts sieve.Options) {
+    domain := address[strings.LastIndex(address, "@")+1:]
+    outDir := filepath.Join(userOutDir, domain, "_autorespond")
+    log.Printf("WARN: autoresponder for %s has no mailbox (forwarder-only address?); not part of any "+
+        "mailbox script, kept in %s", address, outDir)
+    if err := os.MkdirAll(outDir, 0755); err != nil {
+        log.Printf("ERROR: mkdir %s: %v", outDir, err)
+        return
+    }
+    msgPath, settingsPath := autoresponderFiles(homeDir, address)
+    _ = copyFile(msgPath, filepath.Join(outDir, address))
+    if settingsPath != "" {
+        _ = copyFile(settingsPath, filepath.Join(outDir, address+filepath.Ext(settingsPath)))
+    }
+    v, err := ReadAutoresponder(msgPath, settingsPath, address)
+    if err != nil {
+        log.Printf("autoresponder %s: %v", address, err)
+        return
+    }
+    sc, report := sieve.ConvertVacation(address, v, opts)
+    for _, it := range report.Items {
+        log.Printf("REPORT %s (autoresponder): %s", address, it)
+    }
+    if err := sieve.WriteScripts([]sieve.SieveScript{sc}, outDir); err != nil {
+        log.Printf("ERROR: write autoresponder script for %s: %v", address, err)
+    }
+}
+
+// ReadAutoresponder loads a cPanel autoresponder. The message file holds a
+// few headers (From, Subject, Charset, Content-Type), a blank line and the
+// body; the settings file holds interval (hours), start and stop (epoch
+// seconds), either as JSON or as key=value lines.
+func ReadAutoresponder(msgPath, settingsPath, address string) (sieve.Vacation, error) {
+    v := sieve.Vacation{
+        Addresses: []string{address},
+        Interval:  24 * time.Hour, // cPanel's default when no settings exist
+    }
+
+    data, err := os.ReadFile(msgPath)
+    if err != nil {
+        return v, err
+    }
+    text := strings.ReplaceAll(string(data), "\r\n", "\n")
+    head, body := "", text
+    if i := strings.Index(text, "\n\n"); i >= 0 {
+        head, body = text[:i], text[i+2:]
+    }
+    v.Body = body
+
+    for _, line := range strings.Split(head, "\n") {
+        idx := strings.Index(line, ":")
+        if idx < 0 {
+            continue
+        }
+        key := strings.ToLower(strings.TrimSpace(line[:idx]))
+        val := strings.TrimSpace(line[idx+1:])
+        switch key {
+        case "from":
+            v.From = val
+        case "subject":
+            v.Subject = val
+        case "charset":
+            v.Charset = val
+        case "content-type":
+            mediaType, params, err := mime.ParseMediaType(val)
+            if err == nil {
+                v.HTML = mediaType == "text/html"
+                if cs := params["charset"]; cs != "" {
+                    v.Charset = cs
+                }
+            }
+        }
+    }
+
+    if settingsPath == "" {
+        v.Body = toUTF8(v.Body, v.Charset)
+        return v, nil
+    }
+    settings, err := readAutoresponderSettings(settingsPath)
+    if err != nil {
+        return v, fmt.Errorf("%s: %w", settingsPath, err)
+    }
+    if n, err := strconv.ParseInt(settings["interval"], 10, 64); err == nil {
+        v.Interval = time.Duration(n) * time.Hour
+    }
+    if n, err := strconv.ParseInt(settings["start"], 10, 64); err == nil && n > 0 {
+        v.Start = time.Unix(n, 0)
+    }
+    if n, err := strconv.ParseInt(settings["stop"], 10, 64); err == nil && n > 0 {
+        v.Stop = time.Unix(n, 0)
+    }
+    if cs := settings["charset"]; cs != "" {
+        v.Charset = cs
+    }
+    v.Body = toUTF8(v.Body, v.Charset)
+    return v, nil
+}
+
+// toUTF8 converts single-byte Latin-1 bodies; other charsets are expected
+// to be UTF-8 (or ASCII) already, which is what cPanel writes by default.
+func toUTF8(s, charset string) string {
+    if utf8.ValidString(s) {
+        return s
+    }
+    switch strings.ToLower(charset) {
+    case "iso-8859-1", "latin1", "iso_8859-1", "windows-1252", "cp1252":
+        r := make([]rune, len(s))
+        for i := 0; i < len(s); i++ {
+            r[i] = rune(s[i])
+        }
+        return string(r)
+    }
+    return s
+}
+
+// readAutoresponderSettings returns the settings of a .json or .conf file
+// as strings. Missing and null values are left out.
+func readAutoresponderSettings(path string) (map[string]string, error) {
+    out := map[string]string{}
+
+    if strings.HasSuffix(path, ".json") {
+        data, err := os.ReadFile(path)
+        if err != nil {
+            return nil, err
+        }
+        var raw map[string]interface{}
+        if err := json.Unmarshal(data, &raw); err != nil {
+            return nil, err
+        }
+        for k, val := range raw {
+            switch x := val.(type) {
+            case float64:
+                out[strings.ToLower(k)] = strconv.FormatInt(int64(x), 10)
+            case string:
+                out[strings.ToLower(k)] = strings.TrimSpace(x)
+            }
+        }
+        return out, nil
+    }
+
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+    scanner := bufio.NewScanner(f)
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+        idx := strings.Index(line, "=")
+        if idx < 0 {
+            continue
+        }
+        key := strings.ToLower(strings.TrimSpace(line[:idx]))
+        out[key] = strings.TrimSpace(line[idx+1:])
+    }
+    return out, scanner.Err()
+}
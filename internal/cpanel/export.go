@@ -4,8 +4,10 @@ import (
     "fmt"
     "io"
     "io/fs"
+    "log"
     "os"
     "path/filepath"
+    "strings"
 
     "exim2sieve/internal/sieve"
 )
@@ -14,16 +16,39 @@ import (
 //
 // destDir/user/domain/_domain.sieve
 // destDir/user/domain/_domain.filter          (raw /etc/vfilters/domain, if exists)
+// destDir/user/domain/_domain-warnings.json   (parts of the vfilter not converted)
+// destDir/user/domain/_domain.valiases        (raw /etc/valiases/domain, if exists)
+// destDir/user/domain/aliases.json            (parsed forwarders and catch-all)
 // destDir/user/domain/localpart/localpart.sieve
 // destDir/user/domain/localpart/filter        (raw text filter, if exists)
 // destDir/user/domain/localpart/filter.yaml   (raw yaml filter, if exists)
-// destDir/user/domain/localpart/maildir/...   (optional Maildir copy, if withMaildir=true)
-
-func ExportUser(user, destDir string, withMaildir bool) error {
+// destDir/user/domain/localpart/autorespond   (raw ~/.autorespond message + .json/.conf, if exists)
+// destDir/user/domain/localpart/sogo-filters.json    (SOGoSieveFilters, if opts.SOGo)
+// destDir/user/domain/localpart/sogo-extra.sieve     (what SOGo cannot hold, if opts.SOGo)
+// destDir/user/domain/localpart/conversion-report.json (only if lossy)
+// destDir/user/domain/localpart/conversion-warnings.json (parts of the filter not converted)
+// destDir/user/domain/localpart/maildir/...   (optional Maildir copy, if opts.WithMaildir)
+// destDir/user/domain/_autorespond/<address>[.sieve]  (autoresponders of addresses without a mailbox)
+//
+// Every generated script is linted before it is written. Unless opts.Force
+// is set, scripts with lint errors are not written; the export still goes
+// through every mailbox and returns one error listing them at the end.
+// Filter files that were not converted in full are summed up at the end.
+func ExportUser(user, destDir string, opts ExportOptions) error {
     homeDir, err := findHomeDir(user)
     if err != nil {
         return err
     }
+    summary := warningSummary{}
+    defer summary.log()
+    var failed lintFailures
+
+    // Autoresponders are matched to mailboxes below; what is left belongs
+    // to addresses without one.
+    orphans := map[string]bool{}
+    for _, address := range autoresponderAddresses(homeDir) {
+        orphans[strings.ToLower(address)] = true
+    }
 
     etcRoot := filepath.Join(homeDir, "etc")
     entries, err := os.ReadDir(etcRoot)
@@ -54,6 +79,19 @@ func ExportUser(user, destDir string, withMaildir bool) error {
 
 
 
+        // ── 0b) Forwarders: /etc/valiases/<domain> → aliases.json ──────
+        valiasesPath := filepath.Join("/etc/valiases", domain)
+        if fileExists(valiasesPath) {
+            _ = copyFile(valiasesPath, filepath.Join(domainOutDir, "_domain.valiases"))
+            da, err := ParseValiases(valiasesPath, domain)
+            if err != nil {
+                return fmt.Errorf("read valiases for %s: %w", domain, err)
+            }
+            if err := WriteAliases(filepath.Join(domainOutDir, "aliases.json"), da); err != nil {
+                return fmt.Errorf("write aliases for %s: %w", domain, err)
+            }
+        }
+
         // ── 1) Domain-wide filter: /etc/vfilters/<domain> ─────────────
         vfilterPath := filepath.Join("/etc/vfilters", domain)
         if fileExists(vfilterPath) {
@@ -61,11 +99,21 @@ func ExportUser(user, destDir string, withMaildir bool) error {
             _ = copyFile(vfilterPath, filepath.Join(domainOutDir, "_domain.filter"))
 
             // Parse + convert to sieve
-            fDom, err := ParseFilterFile(vfilterPath)
+            fDom, diags, err := ParseFilterFile(vfilterPath)
+            summary.add(domain+"/_domain", diags)
+            if err := WriteWarnings(diags, domain+"/_domain", filepath.Join(domainOutDir, "_domain-warnings.json")); err != nil {
+                return err
+            }
             if err == nil {
-                scripts := sieve.ConvertFilters(fDom)
+                scripts, report := sieve.ConvertFilters(fDom, opts.Sieve)
+                var combined sieve.SieveScript
                 if len(scripts) > 0 {
-                    combined := sieve.CombineScripts("_domain", scripts)
+                    combined = sieve.ApplyDialect(sieve.CombineScripts("_domain", scripts), opts.Sieve, report)
+                }
+                if err := writeReport(report, domain+"/_domain", filepath.Join(domainOutDir, "_domain-report.json")); err != nil {
+                    return err
+                }
+                if len(scripts) > 0 && failed.check(combined, domain+"/_domain.sieve", opts.Force) {
                     if err := sieve.WriteScripts([]sieve.SieveScript{combined}, domainOutDir); err != nil {
                         return fmt.Errorf("write domain sieve for %s: %w", domain, err)
                     }
@@ -97,38 +145,66 @@ func ExportUser(user, destDir string, withMaildir bool) error {
 
             var f sieve.Filter
             var haveFilter bool
+            var diags []Diagnostic
+            where := localpart + "@" + domain
 
             if fileExists(yamlPath) {
                 // Backup original YAML
                 _ = copyFile(yamlPath, filepath.Join(mboxOutDir, "filter.yaml"))
 
                 data, err := os.ReadFile(yamlPath)
-                if err != nil {
-                    continue
+                if err == nil {
+                    err = yamlUnmarshal(data, &f)
                 }
-                if err := yamlUnmarshal(data, &f); err != nil {
-                    continue
+                if err != nil {
+                    diags = append(diags, Diagnostic{File: yamlPath, Reason: fmt.Sprintf("%v; no filter of this file was converted", err)})
+                } else {
+                    haveFilter = true
                 }
-                haveFilter = true
             } else if fileExists(textPath) {
                 // Backup original text filter
                 _ = copyFile(textPath, filepath.Join(mboxOutDir, "filter"))
 
-                parsed, err := ParseFilterFile(textPath)
+                parsed, parseDiags, err := ParseFilterFile(textPath)
+                diags = parseDiags
+                if err == nil {
+                    f = parsed
+                    haveFilter = true
+                } else if len(diags) == 0 {
+                    diags = append(diags, Diagnostic{File: textPath, Reason: err.Error()})
+                }
+            }
+            summary.add(where, diags)
+            if err := WriteWarnings(diags, where, filepath.Join(mboxOutDir, "conversion-warnings.json")); err != nil {
+                return err
+            }
+
+            // cPanel autoresponder for this address (~/.autorespond)
+            address := localpart + "@" + domain
+            delete(orphans, strings.ToLower(address))
+            var vacation *sieve.SieveScript
+            var vacationReport *sieve.Report
+            if msgPath, settingsPath := autoresponderFiles(homeDir, address); msgPath != "" {
+                _ = copyFile(msgPath, filepath.Join(mboxOutDir, "autorespond"))
+                if settingsPath != "" {
+                    _ = copyFile(settingsPath, filepath.Join(mboxOutDir, "autorespond"+filepath.Ext(settingsPath)))
+                }
+                v, err := ReadAutoresponder(msgPath, settingsPath, address)
                 if err != nil {
-                    continue
+                    log.Printf("autoresponder %s: %v", address, err)
+                } else {
+                    sc, report := sieve.ConvertVacation("Autoresponder", v, opts.Sieve)
+                    vacation, vacationReport = &sc, report
                 }
-                f = parsed
-                haveFilter = true
             }
 
-            if !haveFilter {
+            if !haveFilter && vacation == nil {
                 continue
             }
 
 
             // Optional: export Maildir for this mailbox
-            if withMaildir {
+            if opts.WithMaildir {
                 maildirSrc := filepath.Join(homeDir, "mail", domain, localpart)
                 maildirDst := filepath.Join(mboxOutDir, "maildir")
                 if dirExists(maildirSrc) {
@@ -139,21 +215,131 @@ func ExportUser(user, destDir string, withMaildir bool) error {
             }
 
 
-            scripts := sieve.ConvertFilters(f)
+            scripts, report := sieve.ConvertFilters(f, opts.Sieve)
+            if vacation != nil {
+                // The reply goes first so filters that stop cannot skip it.
+                scripts = append([]sieve.SieveScript{*vacation}, scripts...)
+                report.Merge(vacationReport)
+            }
+            if opts.SOGo {
+                sogoReport, err := exportSOGo(f, vacation, mboxOutDir, address, opts, &failed)
+                if err != nil {
+                    return err
+                }
+                report.Merge(sogoReport)
+            }
+            var combined sieve.SieveScript
+            if len(scripts) > 0 {
+                combined = sieve.ApplyDialect(sieve.CombineScripts(localpart, scripts), opts.Sieve, report)
+            }
+            if err := writeReport(report, localpart+"@"+domain, filepath.Join(mboxOutDir, "conversion-report.json")); err != nil {
+                return err
+            }
             if len(scripts) == 0 {
                 continue
             }
 
-            combined := sieve.CombineScripts(localpart, scripts)
+            if !failed.check(combined, localpart+"@"+domain, opts.Force) {
+                continue
+            }
             if err := sieve.WriteScripts([]sieve.SieveScript{combined}, mboxOutDir); err != nil {
                 return fmt.Errorf("write sieve for %s@%s: %w", localpart, domain, err)
             }
         }
     }
 
+    for _, address := range autoresponderAddresses(homeDir) {
+        if orphans[strings.ToLower(address)] {
+            exportOrphanAutoresponder(homeDir, filepath.Join(destDir, user), address, opts.Sieve)
+        }
+    }
+
+    return failed.err()
+}
+
+// ExportOptions controls what ExportUser writes besides the filters.
+type ExportOptions struct {
+    WithMaildir bool // also copy each mailbox's Maildir
+    Force       bool // write scripts even when lint reports errors
+    SOGo        bool // also write the filters in SOGo's format
+    Sieve       sieve.Options
+}
+
+// exportSOGo writes the SOGo form of a mailbox's filters: sogo-filters.json
+// for sogo-tool, and sogo-extra.sieve with the filters SOGo cannot hold plus
+// the autoresponder, which SOGo would otherwise drop on the first save.
+func exportSOGo(f sieve.Filter, vacation *sieve.SieveScript, outDir, where string, opts ExportOptions, failed *lintFailures) (*sieve.Report, error) {
+    filters, rest, report := sieve.ConvertSOGo(f, opts.Sieve)
+    if len(filters) > 0 {
+        if err := sieve.WriteSOGoFilters(filepath.Join(outDir, "sogo-filters.json"), filters); err != nil {
+            return nil, fmt.Errorf("write SOGo filters for %s: %w", where, err)
+        }
+    }
+
+    extra, extraReport := sieve.ConvertFilters(rest, opts.Sieve)
+    report.Merge(extraReport)
+    if vacation != nil {
+        extra = append([]sieve.SieveScript{*vacation}, extra...)
+        if len(filters) > 0 {
+            sieve.NoteSOGoVacation(report, vacation.Name)
+        }
+    }
+    if len(extra) == 0 {
+        return report, nil
+    }
+    combined := sieve.ApplyDialect(sieve.CombineScripts("sogo-extra", extra), opts.Sieve, report)
+    if !failed.check(combined, where+" (sogo-extra)", opts.Force) {
+        return report, nil
+    }
+    if err := sieve.WriteScripts([]sieve.SieveScript{combined}, outDir); err != nil {
+        return nil, fmt.Errorf("write sogo-extra for %s: %w", where, err)
+    }
+    return report, nil
+}
+
+// writeReport logs the conversion report of a mailbox and saves it next to
+// the script. Nothing is written when the conversion was lossless.
+func writeReport(report *sieve.Report, where, path string) error {
+    if len(report.Items) == 0 {
+        return nil
+    }
+    for _, it := range report.Items {
+        log.Printf("REPORT %s: %s", where, it)
+    }
+    if err := report.WriteJSON(path); err != nil {
+        return fmt.Errorf("write conversion report for %s: %w", where, err)
+    }
     return nil
 }
 
+// lintFailures collects the scripts that were not written because of lint
+// errors, so that one bad mailbox does not cut the export short.
+type lintFailures []string
+
+// check logs the lint findings of a generated script and reports whether it
+// may be written: scripts with errors are recorded and skipped unless forced.
+func (l *lintFailures) check(sc sieve.SieveScript, where string, force bool) bool {
+    findings := sieve.Lint(sc)
+    for _, f := range findings {
+        log.Printf("LINT %s: %s", where, f)
+    }
+    if sieve.HasErrors(findings) && !force {
+        log.Printf("ERROR: %s: generated Sieve has lint errors; script not written", where)
+        *l = append(*l, where)
+        return false
+    }
+    return true
+}
+
+// err returns one error naming every skipped script, or nil.
+func (l lintFailures) err() error {
+    if len(l) == 0 {
+        return nil
+    }
+    return fmt.Errorf("generated Sieve has lint errors in %d script(s), not written: %s (use -force to export anyway)",
+        len(l), strings.Join(l, ", "))
+}
+
 // findHomeDir tries /home, /home2, /home3 for the cPanel user.
 func findHomeDir(user string) (string, error) {
     candidates := []string{
@@ -0,0 +1,643 @@
+package cpanel
+
+import (
+    "fmt"
+    "strings"
+    "unicode/utf8"
+)
+
+// SyntaxError is an Exim filter parse error with the position where it
+// occurred.
+type SyntaxError struct {
+    Pos Pos
+    Msg string
+}
+
+func (e *SyntaxError) Error() string {
+    return fmt.Sprintf("line %d, column %d: %s", e.Pos.Line, e.Pos.Column, e.Msg)
+}
+
+// ParseExim parses an Exim filter (the language of cPanel's .filter files
+// and /etc/vfilters) into a syntax tree. Hash comments are kept as the
+// Comments of the following command; comments inside conditions are
+// dropped.
+//
+// Strings are quoted ("..." with backslash escapes) or bare words ending
+// at white space or a parenthesis; ${...} expansions are kept whole.
+// Expansions are not evaluated.
+func ParseExim(src string) (*File, error) {
+    toks, err := lex(src)
+    if err != nil {
+        return nil, err
+    }
+    p := &parser{toks: toks}
+    cmds, end, err := p.commands()
+    if err != nil {
+        return nil, err
+    }
+    if end.kind != tokEOF {
+        return nil, p.errorf(end.pos, "%s without if", end.text)
+    }
+    return &File{Commands: cmds}, nil
+}
+
+// ─────────────────────────────── Lexer ────────────────────────────────
+
+type tokenKind int
+
+const (
+    tokEOF tokenKind = iota
+    tokWord           // bare word: keyword or unquoted string
+    tokString         // quoted string, escapes resolved
+    tokComment        // # to the end of the line
+    tokLParen
+    tokRParen
+)
+
+type token struct {
+    kind tokenKind
+    text string
+    pos  Pos
+}
+
+type lexer struct {
+    src  string
+    off  int
+    line int
+    col  int
+}
+
+func lex(src string) ([]token, error) {
+    l := &lexer{src: src, line: 1, col: 1}
+    var toks []token
+    for {
+        t, err := l.next()
+        if err != nil {
+            return nil, err
+        }
+        toks = append(toks, t)
+        if t.kind == tokEOF {
+            return toks, nil
+        }
+    }
+}
+
+func (l *lexer) pos() Pos {
+    return Pos{Line: l.line, Column: l.col}
+}
+
+func (l *lexer) peek() rune {
+    if l.off >= len(l.src) {
+        return -1
+    }
+    r, _ := utf8.DecodeRuneInString(l.src[l.off:])
+    return r
+}
+
+func (l *lexer) advance() rune {
+    r, size := utf8.DecodeRuneInString(l.src[l.off:])
+    l.off += size
+    if r == '\n' {
+        l.line++
+        l.col = 1
+    } else {
+        l.col++
+    }
+    return r
+}
+
+func isSpace(r rune) bool {
+    return r == ' ' || r == '\t' || r == '\r' || r == '\n'
+}
+
+func (l *lexer) next() (token, error) {
+    for l.off < len(l.src) && isSpace(l.peek()) {
+        l.advance()
+    }
+    start := l.pos()
+    if l.off >= len(l.src) {
+        return token{kind: tokEOF, pos: start}, nil
+    }
+
+    switch l.peek() {
+    case '#':
+        l.advance()
+        begin := l.off
+        for l.off < len(l.src) && l.peek() != '\n' {
+            l.advance()
+        }
+        text := strings.TrimSpace(l.src[begin:l.off])
+        return token{kind: tokComment, text: text, pos: start}, nil
+    case '(':
+        l.advance()
+        return token{kind: tokLParen, text: "(", pos: start}, nil
+    case ')':
+        l.advance()
+        return token{kind: tokRParen, text: ")", pos: start}, nil
+    case '"':
+        l.advance()
+        return l.quoted(start)
+    }
+
+    // Bare word; white space and parentheses inside ${...} belong to it.
+    begin := l.off
+    depth := 0
+    for l.off < len(l.src) {
+        r := l.peek()
+        if depth == 0 && (isSpace(r) || r == '(' || r == ')') {
+            break
+        }
+        switch {
+        case r == '$' && strings.HasPrefix(l.src[l.off:], "${"):
+            l.advance()
+            depth++
+        case r == '}' && depth > 0:
+            depth--
+        case r == '\\' && depth > 0 && l.off+1 < len(l.src):
+            l.advance()
+        }
+        l.advance()
+    }
+    if depth > 0 {
+        return token{}, &SyntaxError{Pos: start, Msg: "unterminated ${ expansion"}
+    }
+    return token{kind: tokWord, text: l.src[begin:l.off], pos: start}, nil
+}
+
+// quoted reads a "..." string after its opening quote. Exim resolves
+// \n, \t, \r, \\, \", octal \ddd and hex \xhh; a backslash at the end of
+// a line continues the string after the leading white space of the next.
+func (l *lexer) quoted(start Pos) (token, error) {
+    var b strings.Builder
+    for l.off < len(l.src) {
+        r := l.advance()
+        switch r {
+        case '"':
+            return token{kind: tokString, text: b.String(), pos: start}, nil
+        case '\\':
+            if l.off >= len(l.src) {
+                continue
+            }
+            e := l.advance()
+            switch {
+            case e == 'n':
+                b.WriteByte('\n')
+            case e == 't':
+                b.WriteByte('\t')
+            case e == 'r':
+                b.WriteByte('\r')
+            case e == '\n' || (e == '\r' && l.peek() == '\n'):
+                for l.off < len(l.src) && isSpace(l.peek()) {
+                    l.advance()
+                }
+            case e >= '0' && e <= '7':
+                n := int(e - '0')
+                for i := 0; i < 2 && l.peek() >= '0' && l.peek() <= '7'; i++ {
+                    n = n*8 + int(l.advance()-'0')
+                }
+                b.WriteByte(byte(n))
+            case e == 'x' && isHex(l.peek()):
+                n := 0
+                for i := 0; i < 2 && isHex(l.peek()); i++ {
+                    n = n*16 + hexVal(l.advance())
+                }
+                b.WriteByte(byte(n))
+            default:
+                b.WriteRune(e)
+            }
+        default:
+            b.WriteRune(r)
+        }
+    }
+    return token{}, &SyntaxError{Pos: start, Msg: "unterminated string"}
+}
+
+func isHex(r rune) bool {
+    return (r >= '0' && r <= '9') || (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F')
+}
+
+func hexVal(r rune) int {
+    switch {
+    case r >= 'a':
+        return int(r-'a') + 10
+    case r >= 'A':
+        return int(r-'A') + 10
+    }
+    return int(r - '0')
+}
+
+// ─────────────────────────────── Parser ───────────────────────────────
+
+type parser struct {
+    toks     []token
+    i        int
+    comments []string // pending hash comments
+}
+
+func (p *parser) errorf(pos Pos, format string, args ...interface{}) error {
+    return &SyntaxError{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// peek returns the next token that is not a comment, collecting the
+// comments it skips.
+func (p *parser) peek() token {
+    for p.toks[p.i].kind == tokComment {
+        p.comments = append(p.comments, p.toks[p.i].text)
+        p.i++
+    }
+    return p.toks[p.i]
+}
+
+func (p *parser) nextTok() token {
+    t := p.peek()
+    if t.kind != tokEOF {
+        p.i++
+    }
+    return t
+}
+
+// word reports whether the next token is the bare word w.
+func (p *parser) word(w string) bool {
+    t := p.peek()
+    return t.kind == tokWord && t.text == w
+}
+
+func (p *parser) expectWord(w string) error {
+    t := p.nextTok()
+    if t.kind != tokWord || t.text != w {
+        return p.errorf(t.pos, "expected %q, found %s", w, describe(t))
+    }
+    return nil
+}
+
+func describe(t token) string {
+    switch t.kind {
+    case tokEOF:
+        return "end of file"
+    case tokString:
+        return fmt.Sprintf("string %q", t.text)
+    }
+    return fmt.Sprintf("%q", t.text)
+}
+
+// value reads a string argument: a quoted string or a bare word.
+func (p *parser) value(what string) (string, error) {
+    t := p.nextTok()
+    if t.kind != tokString && t.kind != tokWord {
+        return "", p.errorf(t.pos, "expected %s, found %s", what, describe(t))
+    }
+    return t.text, nil
+}
+
+// blockEnd are the words that end a list of commands.
+var blockEnd = map[string]bool{"elif": true, "else": true, "endif": true}
+
+// commands parses commands up to the end of the file or a word of
+// blockEnd, which is returned without being consumed.
+func (p *parser) commands() ([]Command, token, error) {
+    var cmds []Command
+    for {
+        t := p.peek()
+        if t.kind == tokEOF || (t.kind == tokWord && blockEnd[t.text]) {
+            p.comments = nil
+            return cmds, t, nil
+        }
+        cmd, err := p.command()
+        if err != nil {
+            return nil, t, err
+        }
+        cmds = append(cmds, cmd)
+    }
+}
+
+func (p *parser) command() (Command, error) {
+    t := p.peek()
+    comments := p.comments
+    p.comments = nil
+    if t.kind != tokWord {
+        return nil, p.errorf(t.pos, "expected a command, found %s", describe(t))
+    }
+    if t.text == "if" {
+        p.nextTok()
+        c, err := p.ifCommand(t.pos)
+        if err != nil {
+            return nil, err
+        }
+        c.Comments = comments
+        return c, nil
+    }
+
+    a := &Action{Pos: t.pos, Comments: comments}
+    for {
+        t = p.nextTok()
+        switch t.text {
+        case "seen":
+            a.Seen = true
+            continue
+        case "unseen":
+            a.Unseen = true
+            continue
+        case "noerror":
+            a.Noerror = true
+            continue
+        }
+        break
+    }
+    if t.kind != tokWord {
+        return nil, p.errorf(t.pos, "expected a command, found %s", describe(t))
+    }
+    a.Name = t.text
+    if err := p.actionArgs(a, t.pos); err != nil {
+        return nil, err
+    }
+    return a, nil
+}
+
+// mailOptions are the options of mail and vacation that take a value;
+// mailFlags take none.
+var mailOptions = map[string]bool{
+    "to": true, "cc": true, "bcc": true, "from": true, "reply_to": true,
+    "subject": true, "text": true, "file": true, "log": true,
+    "once": true, "once_repeat": true, "header": true,
+}
+
+var mailFlags = map[string]bool{"expand": true, "return": true}
+
+func (p *parser) actionArgs(a *Action, pos Pos) error {
+    option := func(name string) error {
+        v, err := p.value(name + " value")
+        if err != nil {
+            return err
+        }
+        if a.Options == nil {
+            a.Options = map[string]string{}
+        }
+        a.Options[name] = v
+        return nil
+    }
+    arg := func(what string) error {
+        v, err := p.value(what)
+        a.Arg = v
+        return err
+    }
+
+    switch a.Name {
+    case "finish":
+    case "deliver":
+        if err := arg("an address"); err != nil {
+            return err
+        }
+        if p.word("errors_to") {
+            p.nextTok()
+            return option("errors_to")
+        }
+    case "save", "logfile":
+        if err := arg("a file name"); err != nil {
+            return err
+        }
+        if t := p.peek(); t.kind == tokWord && t.text != "" && strings.Trim(t.text, "01234567") == "" {
+            p.nextTok()
+            a.Options = map[string]string{"mode": t.text}
+        }
+    case "pipe":
+        return arg("a command")
+    case "logwrite", "testprint":
+        return arg("a string")
+    case "fail", "freeze":
+        if p.word("text") {
+            p.nextTok()
+            return option("text")
+        }
+    case "headers":
+        sub := p.nextTok()
+        switch sub.text {
+        case "add", "remove", "charset":
+        default:
+            return p.errorf(sub.pos, "expected add, remove or charset after headers, found %s", describe(sub))
+        }
+        a.Name = "headers " + sub.text
+        return arg("a header")
+    case "add":
+        // add <number> to <variable>
+        if err := arg("a number"); err != nil {
+            return err
+        }
+        if err := p.expectWord("to"); err != nil {
+            return err
+        }
+        return option("to")
+    case "mail", "vacation":
+        for {
+            t := p.peek()
+            if t.kind != tokWord || (!mailOptions[t.text] && !mailFlags[t.text]) {
+                return nil
+            }
+            p.nextTok()
+            switch {
+            case t.text == "return":
+                if err := p.expectWord("message"); err != nil {
+                    return err
+                }
+                if a.Options == nil {
+                    a.Options = map[string]string{}
+                }
+                a.Options["return message"] = ""
+            case mailFlags[t.text]:
+                if a.Options == nil {
+                    a.Options = map[string]string{}
+                }
+                a.Options[t.text] = ""
+            default:
+                if err := option(t.text); err != nil {
+                    return err
+                }
+            }
+        }
+    default:
+        return p.errorf(pos, "unknown command %q", a.Name)
+    }
+    return nil
+}
+
+// ifCommand parses the rest of an if statement after "if".
+func (p *parser) ifCommand(pos Pos) (*If, error) {
+    c := &If{Pos: pos}
+    for {
+        cond, err := p.cond()
+        if err != nil {
+            return nil, err
+        }
+        p.comments = nil
+        if err := p.expectWord("then"); err != nil {
+            return nil, err
+        }
+        body, end, err := p.commands()
+        if err != nil {
+            return nil, err
+        }
+        c.Branches = append(c.Branches, Branch{Cond: cond, Body: body})
+
+        switch {
+        case end.kind == tokEOF:
+            return nil, p.errorf(pos, "if without endif")
+        case end.text == "elif":
+            p.nextTok()
+            continue
+        case end.text == "else":
+            p.nextTok()
+            body, end, err := p.commands()
+            if err != nil {
+                return nil, err
+            }
+            if end.kind == tokEOF || end.text != "endif" {
+                return nil, p.errorf(end.pos, "expected endif after else, found %s", describe(end))
+            }
+            c.Else = append([]Command{}, body...)
+        }
+        p.nextTok() // endif
+        return c, nil
+    }
+}
+
+// cond parses a condition; "and" binds tighter than "or".
+func (p *parser) cond() (Cond, error) {
+    return p.logic("or", p.andCond)
+}
+
+func (p *parser) andCond() (Cond, error) {
+    return p.logic("and", p.unary)
+}
+
+func (p *parser) logic(op string, operand func() (Cond, error)) (Cond, error) {
+    first, err := operand()
+    if err != nil {
+        return nil, err
+    }
+    terms := []Cond{first}
+    for p.word(op) {
+        p.nextTok()
+        c, err := operand()
+        if err != nil {
+            return nil, err
+        }
+        terms = append(terms, c)
+    }
+    if len(terms) == 1 {
+        return first, nil
+    }
+    return &Logic{Op: op, Terms: terms, Pos: first.Position()}, nil
+}
+
+// condTests are the condition keywords without operands.
+var condTests = map[string]bool{
+    "delivered": true, "error_message": true, "first_delivery": true,
+    "manually_thawed": true, "personal": true,
+}
+
+func (p *parser) unary() (Cond, error) {
+    t := p.peek()
+    switch {
+    case t.kind == tokLParen:
+        p.nextTok()
+        c, err := p.cond()
+        if err != nil {
+            return nil, err
+        }
+        if end := p.nextTok(); end.kind != tokRParen {
+            return nil, p.errorf(end.pos, "expected ), found %s", describe(end))
+        }
+        return c, nil
+    case t.kind == tokWord && t.text == "not":
+        p.nextTok()
+        c, err := p.unary()
+        if err != nil {
+            return nil, err
+        }
+        return &Not{Cond: c, Pos: t.pos}, nil
+    case t.kind == tokWord && t.text == "foranyaddress":
+        p.nextTok()
+        list, err := p.value("an address list")
+        if err != nil {
+            return nil, err
+        }
+        if open := p.nextTok(); open.kind != tokLParen {
+            return nil, p.errorf(open.pos, "expected ( after foranyaddress list, found %s", describe(open))
+        }
+        c, err := p.cond()
+        if err != nil {
+            return nil, err
+        }
+        if end := p.nextTok(); end.kind != tokRParen {
+            return nil, p.errorf(end.pos, "expected ), found %s", describe(end))
+        }
+        return &ForAnyAddress{List: list, Cond: c, Pos: t.pos}, nil
+    case t.kind == tokWord && condTests[t.text]:
+        p.nextTok()
+        test := &Test{Name: t.text, Pos: t.pos}
+        for t.text == "personal" && p.word("alias") {
+            p.nextTok()
+            v, err := p.value("an alias")
+            if err != nil {
+                return nil, err
+            }
+            test.Args = append(test.Args, v)
+        }
+        return test, nil
+    }
+    return p.compare()
+}
+
+// compareVerbs maps Exim's comparison words to Compare.Op.
+var compareVerbs = map[string]string{
+    "contains": "contains", "contain": "contains",
+    "begins": "begins", "begin": "begins",
+    "ends": "ends", "end": "ends",
+    "matches": "matches", "match": "matches",
+    "is": "is",
+}
+
+func (p *parser) compare() (Cond, error) {
+    left := p.nextTok()
+    if left.kind != tokString && left.kind != tokWord {
+        return nil, p.errorf(left.pos, "expected a condition, found %s", describe(left))
+    }
+    c := &Compare{Left: left.text, Pos: left.pos}
+
+    verb := p.nextTok()
+    if verb.kind == tokWord && verb.text == "does" {
+        if err := p.expectWord("not"); err != nil {
+            return nil, err
+        }
+        c.Negated = true
+        verb = p.nextTok()
+    }
+    if verb.kind != tokWord {
+        return nil, p.errorf(verb.pos, "expected a comparison after %s, found %s", describe(left), describe(verb))
+    }
+    word := verb.text
+    if lower := strings.ToLower(word); lower != word && compareVerbs[lower] != "" {
+        c.CaseSensitive = true
+        word = lower
+    }
+    c.Op = compareVerbs[word]
+    if c.Op == "" {
+        return nil, p.errorf(verb.pos, "expected a comparison after %s, found %s", describe(left), describe(verb))
+    }
+
+    if c.Op == "is" && !c.Negated {
+        if p.word("not") {
+            p.nextTok()
+            c.Negated = true
+        }
+        if p.word("above") || p.word("below") {
+            c.Op = p.nextTok().text
+        }
+    }
+
+    right, err := p.value("a value")
+    if err != nil {
+        return nil, err
+    }
+    c.Right = right
+    return c, nil
+}
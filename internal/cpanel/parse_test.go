@@ -0,0 +1,199 @@
+package cpanel
+
+import (
+    "strings"
+    "testing"
+)
+
+func parse(t *testing.T, src string) *File {
+    t.Helper()
+    file, err := ParseExim(src)
+    if err != nil {
+        t.Fatalf("parse: %v", err)
+    }
+    return file
+}
+
+func TestParseNestedIf(t *testing.T) {
+    file := parse(t, `#Lists
+if $h_subject: begins "[list]" then
+  if $h_from: contains "boss" then save "$home/mail/dom/user/.Boss"
+  else save "$home/mail/dom/user/.Lists" endif
+endif
+`)
+    if len(file.Commands) != 1 {
+        t.Fatalf("commands = %d, want 1", len(file.Commands))
+    }
+    outer, ok := file.Commands[0].(*If)
+    if !ok || len(outer.Branches) != 1 || outer.Else != nil {
+        t.Fatalf("outer = %#v", file.Commands[0])
+    }
+    if len(outer.Comments) != 1 || outer.Comments[0] != "Lists" {
+        t.Errorf("comments = %q", outer.Comments)
+    }
+    if got := outer.Branches[0].Cond.String(); got != `$h_subject: begins [list]` {
+        t.Errorf("outer condition = %s", got)
+    }
+    inner, ok := outer.Branches[0].Body[0].(*If)
+    if !ok || len(outer.Branches[0].Body) != 1 {
+        t.Fatalf("outer body = %#v", outer.Branches[0].Body)
+    }
+    if inner.Pos != (Pos{Line: 3, Column: 3}) || len(inner.Else) != 1 {
+        t.Errorf("inner = %+v", inner)
+    }
+    if a := inner.Else[0].(*Action); a.Name != "save" || a.Arg != "$home/mail/dom/user/.Lists" {
+        t.Errorf("else = %+v", a)
+    }
+}
+
+func TestParseElifElse(t *testing.T) {
+    file := parse(t, `if $h_x-spam-score: is above 5 then save $home/mail/d/u/.Junk
+elif $h_subject: does not contain "sale" then deliver shop@ex.gr
+else unseen deliver "all@ex.gr"
+endif
+`)
+    c := file.Commands[0].(*If)
+    if len(c.Branches) != 2 || len(c.Else) != 1 {
+        t.Fatalf("if = %+v", c)
+    }
+    above := c.Branches[0].Cond.(*Compare)
+    if above.Op != "above" || above.Right != "5" || above.Negated {
+        t.Errorf("if condition = %+v", above)
+    }
+    elif := c.Branches[1].Cond.(*Compare)
+    if elif.Op != "contains" || !elif.Negated || elif.Pos.Line != 2 {
+        t.Errorf("elif condition = %+v", elif)
+    }
+    if a := c.Else[0].(*Action); a.Name != "deliver" || a.Arg != "all@ex.gr" || !a.Unseen {
+        t.Errorf("else = %+v", a)
+    }
+}
+
+func TestParseEscapes(t *testing.T) {
+    tests := []struct {
+        quoted string
+        want   string
+    }{
+        {`"say \"hi\""`, `say "hi"`},
+        {`"back\\slash"`, `back\slash`},
+        {`"tab\there\nnew line"`, "tab\there\nnew line"},
+        {`"octal \101\102"`, "octal AB"},
+        {`"hex \x41\x4a"`, "hex AJ"},
+        {`"unknown \q"`, "unknown q"},
+        {"\"long \\\n      line\"", "long line"},
+        {`"$h_from: and ${lc:X}"`, "$h_from: and ${lc:X}"},
+    }
+    for _, tt := range tests {
+        file := parse(t, `if $h_subject: contains `+tt.quoted+` then save x endif`)
+        c := file.Commands[0].(*If).Branches[0].Cond.(*Compare)
+        if c.Right != tt.want {
+            t.Errorf("%s = %q, want %q", tt.quoted, c.Right, tt.want)
+        }
+    }
+}
+
+func TestParseStatementsPerLine(t *testing.T) {
+    file := parse(t, `if $h_to: contains "a" then save A endif if $h_to: contains "b" then save B finish endif
+unseen deliver c@ex.gr save D
+`)
+    want := []struct {
+        pos  Pos
+        kind string
+    }{
+        {Pos{1, 1}, "if"},
+        {Pos{1, 42}, "if"},
+        {Pos{2, 1}, "deliver"},
+        {Pos{2, 24}, "save"},
+    }
+    if len(file.Commands) != len(want) {
+        t.Fatalf("commands = %d, want %d", len(file.Commands), len(want))
+    }
+    for i, w := range want {
+        cmd := file.Commands[i]
+        kind := "if"
+        if a, ok := cmd.(*Action); ok {
+            kind = a.Name
+        }
+        if kind != w.kind || cmd.Position() != w.pos {
+            t.Errorf("command %d = %s at %+v, want %s at %+v", i, kind, cmd.Position(), w.kind, w.pos)
+        }
+    }
+    second := file.Commands[1].(*If).Branches[0].Body
+    if len(second) != 2 || second[1].(*Action).Name != "finish" {
+        t.Errorf("second if body = %+v", second)
+    }
+}
+
+func TestParseLogicInQuotes(t *testing.T) {
+    file := parse(t, `if $h_subject: contains "one and two or three" and not ($h_from: is "x or y" or $h_to: is "and") then save A endif`)
+    and, ok := file.Commands[0].(*If).Branches[0].Cond.(*Logic)
+    if !ok || and.Op != "and" || len(and.Terms) != 2 {
+        t.Fatalf("condition = %s", file.Commands[0].(*If).Branches[0].Cond)
+    }
+    if c := and.Terms[0].(*Compare); c.Right != "one and two or three" {
+        t.Errorf("first term = %+v", c)
+    }
+    not, ok := and.Terms[1].(*Not)
+    if !ok {
+        t.Fatalf("second term = %s", and.Terms[1])
+    }
+    or := not.Cond.(*Logic)
+    if or.Op != "or" || or.Terms[0].(*Compare).Right != "x or y" || or.Terms[1].(*Compare).Right != "and" {
+        t.Errorf("negated term = %s", or)
+    }
+}
+
+// TestConditionString checks that conditions print back as Exim syntax
+// that parses to the same condition.
+func TestConditionString(t *testing.T) {
+    for _, cond := range []string{
+        `$h_subject: contains "a b"`,
+        `$h_subject: does not contain x`,
+        `$h_subject: begins [list]`,
+        `$h_subject: does not end .gr`,
+        `$h_subject: matches "^re: \\d+"`,
+        `$h_subject: does not match x`,
+        `$h_from: is boss@ex.gr`,
+        `$h_from: is not boss@ex.gr`,
+        `$h_from: Is not boss@ex.gr`,
+        `$h_subject: Contains URGENT`,
+        `$h_subject: does not Begin Re:`,
+        `$message_size is above 10K`,
+        `$h_x-spam-score: is not below 5`,
+        `$h_to: contains a and ($h_cc: contains b or $h_cc: contains c)`,
+        `not ($h_to: contains a or $h_cc: contains b)`,
+        `not $h_to: contains "say \"hi\""`,
+        `foranyaddress $h_to:,$h_cc: ($thisaddress is a@ex.gr)`,
+    } {
+        file := parse(t, "if "+cond+" then save x endif")
+        got := file.Commands[0].(*If).Branches[0].Cond.String()
+        if got != cond {
+            t.Errorf("%s printed as %s", cond, got)
+        }
+    }
+}
+
+func TestParseEximErrors(t *testing.T) {
+    tests := []struct {
+        src  string
+        line int
+        msg  string // part of the message
+    }{
+        {"if $h_to: contains \"a\" then\n  save A\n", 1, "endif"},
+        {"save A\nendif\n", 2, "endif without if"},
+        {"if $h_to: contains \"a\n", 1, "unterminated string"},
+        {"if $h_to: resembles \"a\" then save A endif", 1, "expected a comparison"},
+        {"deliver ${lc:$h_to:\n", 1, "unterminated ${"},
+    }
+    for _, tt := range tests {
+        _, err := ParseExim(tt.src)
+        se, ok := err.(*SyntaxError)
+        if !ok {
+            t.Errorf("ParseExim(%q) = %v, want a SyntaxError", tt.src, err)
+            continue
+        }
+        if se.Pos.Line != tt.line || !strings.Contains(se.Msg, tt.msg) {
+            t.Errorf("ParseExim(%q) = %v, want line %d and %q", tt.src, err, tt.line, tt.msg)
+        }
+    }
+}
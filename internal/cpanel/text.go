@@ -1,17 +1,17 @@
 package cpanel
 
 import (
-    "bufio"
-    "os"
+    "errors"
+    "fmt"
+    "io/ioutil"
     "strings"
 
     "exim2sieve/internal/sieve"
 )
 
-// ParseFilterFile parses a cPanel-style Exim filter text file ("filter")
-// into a sieve.Filter structure.
-//
-// Supports simple patterns like:
+// ParseFilterFile parses a cPanel-style Exim filter text file ("filter",
+// /etc/vfilters/<domain> or a hand-edited .filter) into a sieve.Filter
+// structure, e.g.:
 //
 // #Name
 // if
@@ -22,255 +22,417 @@ import (
 //  finish
 // endif
 //
-// Anything more complex (nested ifs, error_message stuff) is ignored for now.
-func ParseFilterFile(path string) (sieve.Filter, error) {
-    f, err := os.Open(path)
+// Every top-level if becomes one or more filter entries named after the
+// "#Name" comment before it (see Lower). What cannot be converted is
+// returned as diagnostics; a syntax error also returns an error, with the
+// file as a whole left out.
+func ParseFilterFile(path string) (sieve.Filter, []Diagnostic, error) {
+    data, err := ioutil.ReadFile(path)
     if err != nil {
-        return sieve.Filter{}, err
+        return sieve.Filter{}, nil, err
+    }
+    lines := strings.Split(string(data), "\n")
+    text := func(line int) string {
+        if line < 1 || line > len(lines) {
+            return ""
+        }
+        return strings.TrimSpace(lines[line-1])
     }
-    defer f.Close()
-
-    scanner := bufio.NewScanner(f)
-
-    var entries []sieve.FilterEntry
-    var curName string
-    var condLines []string
-    var actionLines []string
-    inIf := false
-    inThen := false
 
-    flush := func() {
-        if curName == "" || len(condLines) == 0 {
-            curName = ""
-            condLines = nil
-            actionLines = nil
-            inIf = false
-            inThen = false
-            return
+    file, err := ParseExim(string(data))
+    if err != nil {
+        var se *SyntaxError
+        if !errors.As(err, &se) {
+            return sieve.Filter{}, nil, err
+        }
+        d := Diagnostic{
+            File:   path,
+            Line:   se.Pos.Line,
+            Text:   text(se.Pos.Line),
+            Reason: fmt.Sprintf("syntax error at column %d: %s; no filter of this file was converted", se.Pos.Column, se.Msg),
         }
+        return sieve.Filter{}, []Diagnostic{d}, fmt.Errorf("%s: %w", path, err)
+    }
 
-        rules := parseConditions(condLines)
-        actions := parseActions(actionLines)
+    f, diags := Lower(file)
+    for i := range diags {
+        diags[i].File = path
+        diags[i].Text = text(diags[i].Line)
+    }
+    return f, diags, nil
+}
 
-        if len(rules) == 0 || len(actions) == 0 {
-            // nothing useful
-            curName = ""
-            condLines = nil
-            actionLines = nil
-            inIf = false
-            inThen = false
+// Lower turns a parsed Exim filter into the filter entries the converter
+// consumes.
+//
+// Each top-level if is split into its paths: every combination of taken
+// and skipped branches, including those of nested ifs, that runs at least
+// one action. A path becomes one entry whose rules are the path's
+// conditions in disjunctive normal form, so and/or/not/elif/else all end
+// up as a plain cPanel rule chain. The paths of an if exclude each other,
+// so their order does not matter. Actions outside any if become an entry
+// without rules.
+//
+// The diagnostics carry the line and reason of everything left out; File
+// and Text are filled in by ParseFilterFile.
+func Lower(file *File) (sieve.Filter, []Diagnostic) {
+    l := &lowerer{}
+    var loose []Command
+    looseName := ""
+
+    flushLoose := func() {
+        if len(loose) == 0 {
             return
         }
-
-        entries = append(entries, sieve.FilterEntry{
-            Filtername: curName,
-            Enabled:    1,
-            Rules:      rules,
-            Actions:    actions,
-        })
-
-        curName = ""
-        condLines = nil
-        actionLines = nil
-        inIf = false
-        inThen = false
+        for _, path := range l.paths(loose, []path{{}}) {
+            l.entry(looseName, path)
+        }
+        loose, looseName = nil, ""
     }
 
-    for scanner.Scan() {
-        line := strings.TrimSpace(scanner.Text())
-        if line == "" {
-            continue
+    for _, cmd := range file.Commands {
+        switch c := cmd.(type) {
+        case *If:
+            flushLoose()
+            if guard(c) {
+                continue
+            }
+            name := filterName(c.Comments)
+            if name == "" {
+                name = fmt.Sprintf("Filter at line %d", c.Pos.Line)
+            }
+            entries, issues := len(l.entries), len(l.issues)
+            for _, path := range l.paths([]Command{c}, []path{{}}) {
+                l.entry(name, path)
+            }
+            if len(l.entries) == entries && len(l.issues) == issues {
+                l.issue(c.Pos, "filter %q has no actions; nothing to convert", name)
+            }
+        case *Action:
+            if c.Name == "headers charset" {
+                continue
+            }
+            if len(loose) == 0 {
+                looseName = filterName(c.Comments)
+                if looseName == "" {
+                    looseName = fmt.Sprintf("Filter at line %d", c.Pos.Line)
+                }
+            }
+            loose = append(loose, c)
         }
+    }
+    flushLoose()
 
-        // Skip boilerplate
-        if strings.HasPrefix(line, "# Exim filter") ||
-            strings.HasPrefix(line, "# Do not manually") ||
-            strings.HasPrefix(line, "headers charset") ||
-            strings.HasPrefix(line, "if not first_delivery") {
-            continue
-        }
+    return sieve.Filter{Filter: l.entries, Version: "text"}, l.issues
+}
 
-        // New filter: "#Name"
-        if strings.HasPrefix(line, "#") && !inIf && !inThen {
-            flush()
-            curName = strings.TrimSpace(strings.TrimPrefix(line, "#"))
+// filterName returns the cPanel rule name from the comments before an if,
+// skipping the "# Exim filter" header and cPanel's boilerplate.
+func filterName(comments []string) string {
+    name := ""
+    for _, c := range comments {
+        lower := strings.ToLower(c)
+        if c == "" || strings.HasPrefix(lower, "exim filter") || strings.HasPrefix(lower, "do not manually") {
             continue
         }
+        name = c
+    }
+    return name
+}
 
-        // Start of IF
-        if strings.HasPrefix(line, "if") && !inIf && !inThen {
-            rest := strings.TrimSpace(strings.TrimPrefix(line, "if"))
-            inIf = true
-            if rest != "" {
-                condLines = append(condLines, rest)
-            }
-            continue
+// guard reports cPanel's "if not first_delivery [and error_message] then
+// finish endif" preamble, which has no meaning in Sieve.
+func guard(c *If) bool {
+    if len(c.Branches) != 1 || c.Else != nil {
+        return false
+    }
+    for _, cmd := range c.Branches[0].Body {
+        if a, ok := cmd.(*Action); !ok || a.Name != "finish" {
+            return false
         }
-
-        if inIf {
-            if strings.HasPrefix(line, "then") {
-                inIf = false
-                inThen = true
-                continue
-            }
-            condLines = append(condLines, line)
-            continue
+    }
+    onlyTests := true
+    walkCond(c.Branches[0].Cond, func(cond Cond) {
+        if _, ok := cond.(*Compare); ok {
+            onlyTests = false
+        }
+        if _, ok := cond.(*ForAnyAddress); ok {
+            onlyTests = false
         }
+    })
+    return onlyTests
+}
 
-        if inThen {
-            if strings.HasPrefix(line, "endif") {
-                inThen = false
-                flush()
-                continue
-            }
-            actionLines = append(actionLines, line)
-            continue
+func walkCond(c Cond, fn func(Cond)) {
+    fn(c)
+    switch c := c.(type) {
+    case *Logic:
+        for _, t := range c.Terms {
+            walkCond(t, fn)
         }
+    case *Not:
+        walkCond(c.Cond, fn)
+    case *ForAnyAddress:
+        walkCond(c.Cond, fn)
     }
+}
 
-    if err := scanner.Err(); err != nil {
-        return sieve.Filter{}, err
+type lowerer struct {
+    entries []sieve.FilterEntry
+    issues  []Diagnostic
+}
+
+// issue records a problem once, even when several paths run into it.
+func (l *lowerer) issue(pos Pos, format string, args ...interface{}) {
+    is := Diagnostic{Line: pos.Line, Reason: fmt.Sprintf(format, args...)}
+    for _, seen := range l.issues {
+        if seen == is {
+            return
+        }
     }
+    l.issues = append(l.issues, is)
+}
 
-    // Just in case file doesn't end with endif
-    flush()
+// path is one way through a list of commands: the conditions that hold on
+// it (as written, negated ones wrapped in Not) and the actions it runs.
+type path struct {
+    conds   []Cond
+    actions []*Action
+}
 
-    return sieve.Filter{
-        Filter:  entries,
-        Version: "text",
-    }, nil
+// paths extends each of in with the commands in order.
+func (l *lowerer) paths(cmds []Command, in []path) []path {
+    for _, cmd := range cmds {
+        switch c := cmd.(type) {
+        case *Action:
+            for i := range in {
+                in[i].actions = append(append([]*Action{}, in[i].actions...), c)
+            }
+        case *If:
+            var out []path
+            var skipped []Cond // branches before this one did not match
+            for _, b := range c.Branches {
+                conds := append(append([]Cond{}, skipped...), b.Cond)
+                out = append(out, l.paths(b.Body, withConds(in, conds))...)
+                skipped = append(skipped, &Not{Cond: b.Cond, Pos: b.Cond.Position()})
+            }
+            out = append(out, l.paths(c.Else, withConds(in, skipped))...)
+            in = out
+        }
+    }
+    return in
 }
 
-// ───── Conditions parser ─────
+func withConds(in []path, conds []Cond) []path {
+    out := make([]path, len(in))
+    for i, p := range in {
+        out[i] = path{
+            conds:   append(append([]Cond{}, p.conds...), conds...),
+            actions: append([]*Action{}, p.actions...),
+        }
+    }
+    return out
+}
 
-func parseConditions(lines []string) []sieve.Rule {
-    joined := strings.Join(lines, " ")
-    joined = strings.TrimSpace(joined)
-    if joined == "" {
-        return nil
+// entry adds the filter entry for one path.
+func (l *lowerer) entry(name string, p path) {
+    if len(p.actions) == 0 {
+        return
+    }
+    var cond Cond
+    if len(p.conds) == 1 {
+        cond = p.conds[0]
+    } else if len(p.conds) > 1 {
+        cond = &Logic{Op: "and", Terms: p.conds, Pos: p.conds[0].Position()}
     }
 
-    // We support simple patterns like:
-    //
-    // $header_from: contains "foo"
-    // or $header_subject: begins "WHMCS"
-    // and $header_from: contains "myip"
-    //
     var rules []sieve.Rule
-
-    s := joined
-    first := true
-
-    for {
-        s = strings.TrimSpace(s)
-        if s == "" {
-            break
+    if cond != nil {
+        dnf, err := disjunctive(cond, false)
+        if err != nil {
+            l.issue(err.pos, "%s; skipped: %s", err.msg, cond)
+            return
         }
-
-        opt := "or"
-        if !first {
-            lower := strings.ToLower(s)
-            switch {
-            case strings.HasPrefix(lower, "or "):
-                opt = "or"
-                s = strings.TrimSpace(s[3:])
-            case strings.HasPrefix(lower, "and "):
-                opt = "and"
-                s = strings.TrimSpace(s[4:])
+        for _, conj := range dnf {
+            for i, lit := range conj {
+                r, err := l.rule(lit)
+                if err != nil {
+                    l.issue(err.pos, "%s; skipped: %s", err.msg, cond)
+                    return
+                }
+                r.Opt = "or"
+                if i > 0 {
+                    r.Opt = "and"
+                }
+                rules = append(rules, r)
             }
         }
-        first = false
+    }
 
-        if s == "" {
-            break
+    actions := l.actions(p.actions)
+    if len(actions) == 0 {
+        return
+    }
+    l.entries = append(l.entries, sieve.FilterEntry{
+        Filtername: l.uniqueName(name),
+        Enabled:    1,
+        Rules:      rules,
+        Actions:    actions,
+    })
+}
+
+// uniqueName numbers the second and later entries with the same name.
+func (l *lowerer) uniqueName(name string) string {
+    n := 0
+    for _, e := range l.entries {
+        if e.Filtername == name || strings.HasPrefix(e.Filtername, name+" (") {
+            n++
         }
+    }
+    if n == 0 {
+        return name
+    }
+    return fmt.Sprintf("%s (%d)", name, n+1)
+}
+
+type lowerError struct {
+    pos Pos
+    msg string
+}
 
-        // Find next " or " / " and " to isolate this condition
-        lower := strings.ToLower(s)
-        nextOr := strings.Index(lower, " or ")
-        nextAnd := strings.Index(lower, " and ")
-        cut := len(s)
-        if nextOr >= 0 && nextOr < cut {
-            cut = nextOr
+// maxTerms bounds the disjunctive normal form of a condition.
+const maxTerms = 64
+
+// conj is an and-group of literals: Compares with the negation folded
+// in, or ForAnyAddress and Test conditions, possibly under one Not.
+type conj []Cond
+
+// disjunctive returns c (negated if neg) as an or of and-groups of literals.
+func disjunctive(c Cond, neg bool) ([]conj, *lowerError) {
+    switch c := c.(type) {
+    case *Not:
+        return disjunctive(c.Cond, !neg)
+    case *Compare:
+        if neg {
+            n := *c
+            n.Negated = !n.Negated
+            return []conj{{&n}}, nil
         }
-        if nextAnd >= 0 && nextAnd < cut {
-            cut = nextAnd
+        return []conj{{c}}, nil
+    case *Logic:
+        // De Morgan: a negated and is an or of negations and vice versa.
+        and := (c.Op == "and") != neg
+        var out []conj
+        for i, t := range c.Terms {
+            d, err := disjunctive(t, neg)
+            if err != nil {
+                return nil, err
+            }
+            switch {
+            case !and:
+                out = append(out, d...)
+            case i == 0:
+                out = d
+            default:
+                var product []conj
+                for _, a := range out {
+                    for _, b := range d {
+                        product = append(product, append(append(conj{}, a...), b...))
+                    }
+                }
+                out = product
+            }
+            if len(out) > maxTerms {
+                return nil, &lowerError{c.Pos, "condition is too complex"}
+            }
         }
-        expr := strings.TrimSpace(s[:cut])
-        if cut < len(s) {
-            s = s[cut:]
-        } else {
-            s = ""
+        return out, nil
+    default:
+        if neg {
+            return []conj{{&Not{Cond: c, Pos: c.Position()}}}, nil
         }
+        return []conj{{c}}, nil
+    }
+}
 
-        if expr == "" {
-            continue
-        }
+// compareMatches maps Compare.Op (and its negation) to cPanel match names.
+var compareMatches = map[string][2]string{
+    "contains": {"contains", "does not contain"},
+    "is":       {"is", "is not"},
+    "begins":   {"begins", "does not begin"},
+    "ends":     {"ends", "does not end"},
+    "matches":  {"matches", "does not match"},
+    "above":    {"is above", "is not above"},
+    "below":    {"is below", "is not below"},
+}
 
-        // expr looks like: $header_from: contains "foo"
-        colon := strings.Index(expr, ":")
-        if colon < 0 {
-            continue
+// anyRecipient are the headers of cPanel's "any recipient" part.
+var anyRecipient = map[string]bool{"to": true, "cc": true, "bcc": true}
+
+// rule converts one literal into a cPanel rule.
+func (l *lowerer) rule(c Cond) (sieve.Rule, *lowerError) {
+    switch c := c.(type) {
+    case *Compare:
+        m := compareMatches[c.Op]
+        match := m[0]
+        if c.Negated {
+            match = m[1]
         }
-        part := strings.TrimSpace(expr[:colon+1])
-        rest := strings.TrimSpace(expr[colon+1:])
-
-        fields := strings.Fields(rest)
-        if len(fields) == 0 {
-            continue
+        return sieve.Rule{Part: c.Left, Match: match, Val: c.Right, CaseSensitive: c.CaseSensitive}, nil
+    case *ForAnyAddress:
+        cmp, ok := c.Cond.(*Compare)
+        if !ok || cmp.Left != "$thisaddress" {
+            return sieve.Rule{}, &lowerError{c.Pos, "foranyaddress only converts with a single test of $thisaddress"}
         }
-        match := strings.ToLower(fields[0])
-
-        // Extract quoted value
-        q1 := strings.Index(rest, "\"")
-        if q1 < 0 {
-            continue
+        var headers []string
+        for _, item := range strings.Split(c.List, ",") {
+            h := strings.ToLower(strings.TrimSpace(item))
+            h = strings.TrimPrefix(h, "$")
+            for _, prefix := range []string{"header_", "h_", "rheader_", "rh_"} {
+                h = strings.TrimPrefix(h, prefix)
+            }
+            headers = append(headers, strings.TrimSuffix(h, ":"))
         }
-        vPart := rest[q1+1:]
-        q2 := strings.Index(vPart, "\"")
-        if q2 < 0 {
-            continue
+        r, _ := l.rule(cmp)
+        switch {
+        case len(headers) == 1:
+            r.Part = "$header_" + headers[0] + ":"
+        case allIn(headers, anyRecipient):
+            r.Part = "any recipient"
+        default:
+            return sieve.Rule{}, &lowerError{c.Pos, fmt.Sprintf("foranyaddress over %q has no cPanel equivalent", c.List)}
+        }
+        return r, nil
+    case *Not:
+        if _, ok := c.Cond.(*ForAnyAddress); ok {
+            return sieve.Rule{}, &lowerError{c.Pos, fmt.Sprintf("%q cannot be negated in Sieve", c.Cond.String())}
         }
-        val := vPart[:q2]
-
-        rules = append(rules, sieve.Rule{
-            Part:  part,
-            Match: match,
-            Val:   val,
-            Opt:   opt,
-        })
     }
-
-    return rules
+    return sieve.Rule{}, &lowerError{c.Position(), fmt.Sprintf("condition %q has no Sieve equivalent", c.String())}
 }
 
-// ───── Actions parser ─────
-
-func parseActions(lines []string) []sieve.Action {
-    var acts []sieve.Action
-
-    for _, line := range lines {
-        line = strings.TrimSpace(line)
-        if line == "" {
-            continue
-        }
-        lower := strings.ToLower(line)
-
-        if strings.HasPrefix(lower, "finish") {
-            acts = append(acts, sieve.Action{Action: "finish"})
-            continue
+func allIn(list []string, set map[string]bool) bool {
+    for _, s := range list {
+        if !set[s] {
+            return false
         }
+    }
+    return true
+}
 
-        if strings.HasPrefix(lower, "deliver ") {
-            arg := extractFirstQuoted(line)
-            if arg == "" {
-                continue
-            }
-
+// actions converts the actions of a path.
+func (l *lowerer) actions(cmds []*Action) []sieve.Action {
+    var acts []sieve.Action
+    for _, a := range cmds {
+        switch a.Name {
+        case "finish":
+            // "seen finish": the message counts as delivered and is
+            // dropped unless the filter delivered it somewhere.
+            acts = append(acts, sieve.Action{Action: "finish", Seen: a.Seen})
+        case "deliver":
             // Special-case: deliver "\"$local_part+Nixpal\"@$domain"
-            if strings.Contains(arg, "$local_part+") {
-                idx := strings.Index(arg, "$local_part+")
-                rest := arg[idx+len("$local_part+"):]
+            if idx := strings.Index(a.Arg, "$local_part+"); idx >= 0 {
+                rest := a.Arg[idx+len("$local_part+"):]
                 name := rest
                 if i := strings.IndexAny(rest, "\"@"); i >= 0 {
                     name = rest[:i]
@@ -280,45 +442,23 @@ func parseActions(lines []string) []sieve.Action {
                     acts = append(acts, sieve.Action{
                         Action: "save",
                         Dest:   name, // mailbox name like "Nixpal"
+                        Unseen: a.Unseen,
                     })
+                    continue
                 }
-            } else {
-                // deliver "logs@myip.gr"  → treat as redirect-like
-                acts = append(acts, sieve.Action{
-                    Action: "deliver",
-                    Dest:   arg,
-                })
             }
-            continue
+            // deliver "logs@myip.gr"  → redirect
+            acts = append(acts, sieve.Action{Action: "deliver", Dest: a.Arg, Unseen: a.Unseen})
+        case "save", "pipe":
+            acts = append(acts, sieve.Action{Action: a.Name, Dest: a.Arg, Unseen: a.Unseen})
+        case "fail", "freeze":
+            // the text is optional
+            acts = append(acts, sieve.Action{Action: a.Name, Dest: a.Options["text"]})
+        case "logwrite", "logfile", "testprint", "headers charset":
+            // no effect on delivery
+        default:
+            l.issue(a.Pos, "%s has no Sieve equivalent; left out", a.Name)
         }
-
-        if strings.HasPrefix(lower, "save ") {
-            arg := extractFirstQuoted(line)
-            if arg == "" {
-                continue
-            }
-            acts = append(acts, sieve.Action{
-                Action: "save",
-                Dest:   arg,
-            })
-            continue
-        }
-
-        // For now ignore anything else (nested ifs etc.)
     }
-
     return acts
 }
-
-func extractFirstQuoted(s string) string {
-    start := strings.Index(s, "\"")
-    if start < 0 {
-        return ""
-    }
-    rest := s[start+1:]
-    end := strings.Index(rest, "\"")
-    if end < 0 {
-        return ""
-    }
-    return rest[:end]
-}
@@ -0,0 +1,177 @@
+package cpanel
+
+import (
+    "strings"
+    "testing"
+
+    "exim2sieve/internal/sieve"
+)
+
+// lower parses and lowers an Exim filter, failing on syntax errors.
+func lower(t *testing.T, src string) (sieve.Filter, []Diagnostic) {
+    t.Helper()
+    file, err := ParseExim(src)
+    if err != nil {
+        t.Fatalf("parse: %v", err)
+    }
+    return Lower(file)
+}
+
+func TestLowerCaseSensitive(t *testing.T) {
+    f, diags := lower(t, `# Exim filter
+if $h_subject: Contains "URGENT" or $h_from: is "boss@ex.gr" then
+  save $home/mail/ex.gr/chris/.Urgent
+endif
+`)
+    if len(diags) != 0 || len(f.Filter) != 1 {
+        t.Fatalf("filter = %+v, diagnostics %v", f, diags)
+    }
+    rules := f.Filter[0].Rules
+    if len(rules) != 2 || !rules[0].CaseSensitive || rules[1].CaseSensitive {
+        t.Errorf("rules = %+v, want only Contains case-sensitive", rules)
+    }
+}
+
+// entryString writes a filter entry as "name: rule, rule => action, action"
+// with rules as "part|match|val" joined by their opt.
+func entryString(e sieve.FilterEntry) string {
+    var rules []string
+    for i, r := range e.Rules {
+        s := r.Part + "|" + r.Match + "|" + r.Val
+        if i > 0 {
+            s = r.Opt + " " + s
+        }
+        rules = append(rules, s)
+    }
+    var actions []string
+    for _, a := range e.Actions {
+        s := a.Action
+        if a.Dest != "" {
+            s += " " + a.Dest
+        }
+        if a.Unseen {
+            s = "unseen " + s
+        }
+        actions = append(actions, s)
+    }
+    return e.Filtername + ": " + strings.Join(rules, " ") + " => " + strings.Join(actions, ", ")
+}
+
+func TestLower(t *testing.T) {
+    tests := []struct {
+        name    string
+        src     string
+        entries []string
+    }{
+        {
+            name: "nested if",
+            src: `#Lists
+if $h_subject: begins "[list]" then
+  if $h_from: contains "boss" then save "$home/mail/dom/user/.Boss"
+  else save "$home/mail/dom/user/.Lists" endif
+endif
+`,
+            entries: []string{
+                "Lists: $h_subject:|begins|[list] and $h_from:|contains|boss => save $home/mail/dom/user/.Boss",
+                "Lists (2): $h_subject:|begins|[list] and $h_from:|does not contain|boss => save $home/mail/dom/user/.Lists",
+            },
+        },
+        {
+            name: "elif and else",
+            src: `#Spam
+if $h_x-spam-score: is above 5 then save $home/mail/d/u/.Junk
+elif $h_subject: contains "sale" then deliver shop@ex.gr
+else unseen deliver "all@ex.gr"
+endif
+`,
+            entries: []string{
+                "Spam: $h_x-spam-score:|is above|5 => save $home/mail/d/u/.Junk",
+                "Spam (2): $h_x-spam-score:|is not above|5 and $h_subject:|contains|sale => deliver shop@ex.gr",
+                "Spam (3): $h_x-spam-score:|is not above|5 and $h_subject:|does not contain|sale => unseen deliver all@ex.gr",
+            },
+        },
+        {
+            name: "escapes",
+            src: `#Quoted
+if $h_subject: contains "say \"hi\" \\ \x41" then save "$home/mail/d/u/.Q" endif
+`,
+            entries: []string{
+                `Quoted: $h_subject:|contains|say "hi" \ A => save $home/mail/d/u/.Q`,
+            },
+        },
+        {
+            name: "statements on one line",
+            src: `if $h_to: contains "a" then save $home/mail/d/u/.A endif if $h_to: contains "b" then save $home/mail/d/u/.B finish endif
+`,
+            entries: []string{
+                "Filter at line 1: $h_to:|contains|a => save $home/mail/d/u/.A",
+                "Filter at line 1 (2): $h_to:|contains|b => save $home/mail/d/u/.B, finish",
+            },
+        },
+        {
+            name: "and/or inside quotes",
+            src: `#Words
+if $h_subject: contains "one and two" or $h_subject: contains "three or four" and $h_from: is "x and y" then
+  save $home/mail/d/u/.W
+endif
+`,
+            entries: []string{
+                "Words: $h_subject:|contains|one and two or $h_subject:|contains|three or four and $h_from:|is|x and y => save $home/mail/d/u/.W",
+            },
+        },
+        {
+            name: "negated or",
+            src: `#Not
+if not ($h_to: contains "a" or $h_cc: contains "b") then save $home/mail/d/u/.N endif
+`,
+            entries: []string{
+                "Not: $h_to:|does not contain|a and $h_cc:|does not contain|b => save $home/mail/d/u/.N",
+            },
+        },
+        {
+            name: "actions outside if",
+            src: `# Exim filter
+#Copy
+unseen deliver copy@ex.gr
+`,
+            entries: []string{
+                "Copy:  => unseen deliver copy@ex.gr",
+            },
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            f, diags := lower(t, tt.src)
+            if len(diags) != 0 {
+                t.Errorf("diagnostics: %v", diags)
+            }
+            var got []string
+            for _, e := range f.Filter {
+                got = append(got, entryString(e))
+            }
+            if strings.Join(got, "\n") != strings.Join(tt.entries, "\n") {
+                t.Errorf("entries:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.entries, "\n"))
+            }
+        })
+    }
+}
+
+func TestLowerDiagnostics(t *testing.T) {
+    f, diags := lower(t, `#Personal
+if personal then save $home/mail/d/u/.P endif
+#Mail
+if $h_subject: contains "x" then
+  mail to a@ex.gr subject "hi"
+  save $home/mail/d/u/.X
+endif
+`)
+    if len(f.Filter) != 1 || entryString(f.Filter[0]) != "Mail: $h_subject:|contains|x => save $home/mail/d/u/.X" {
+        t.Errorf("entries = %+v", f.Filter)
+    }
+    if len(diags) != 2 || diags[0].Line != 2 || diags[1].Line != 5 {
+        t.Fatalf("diagnostics = %v, want lines 2 and 5", diags)
+    }
+    if !strings.Contains(diags[0].Reason, "personal") {
+        t.Errorf("diagnostic = %v", diags[0])
+    }
+}
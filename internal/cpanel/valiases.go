@@ -0,0 +1,202 @@
+package cpanel
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "log"
+    "os"
+    "strings"
+
+    "exim2sieve/internal/sieve"
+)
+
+// Alias target kinds found in /etc/valiases/<domain>.
+const (
+    TargetAddress   = "address"   // forward to an address
+    TargetLocalUser = "localuser" // bare name: a system (cPanel) account, not an address
+    TargetPipe      = "pipe"      // "|/path/to/program args"
+    TargetFail      = "fail"      // ":fail: message" - bounce
+    TargetBlackhole = "blackhole" // ":blackhole:" - drop silently
+)
+
+// AliasTarget is one destination of a forwarder.
+type AliasTarget struct {
+    Kind  string `json:"kind"`
+    Value string `json:"value,omitempty"` // address, command or fail message
+}
+
+// Alias is one valiases line. CatchAll aliases have Source "*@<domain>".
+type Alias struct {
+    Source   string        `json:"source"`
+    CatchAll bool          `json:"catch_all,omitempty"`
+    Targets  []AliasTarget `json:"targets"`
+    Line     int           `json:"line"`
+}
+
+// LocalPart returns the part of Source before the "@".
+func (a Alias) LocalPart() string {
+    if i := strings.LastIndex(a.Source, "@"); i >= 0 {
+        return a.Source[:i]
+    }
+    return a.Source
+}
+
+// DomainAliases is the aliases.json written per domain by ExportUser.
+type DomainAliases struct {
+    Domain  string  `json:"domain"`
+    Aliases []Alias `json:"aliases"`
+}
+
+// ParseValiases reads /etc/valiases/<domain>:
+//
+//   chris@myip.gr: other@gmail.com, chris2@myip.gr
+//   info@myip.gr: "|/home/user/bin/ticket.php"
+//   old@myip.gr: :fail: No such user here
+//   spam@myip.gr: :blackhole:
+//   *: chris@myip.gr
+//
+// A target without "@" names a system account (e.g. "*: cpuser"); it is
+// kept as a TargetLocalUser and reported, never guessed as name@domain.
+func ParseValiases(path, domain string) (DomainAliases, error) {
+    out := DomainAliases{Domain: domain, Aliases: []Alias{}}
+
+    f, err := os.Open(path)
+    if err != nil {
+        return out, err
+    }
+    defer f.Close()
+
+    scanner := bufio.NewScanner(f)
+    lineNo := 0
+    for scanner.Scan() {
+        lineNo++
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        idx := strings.Index(line, ":")
+        if idx <= 0 {
+            log.Printf("WARN: %s:%d: missing \":\" after the alias name, skipped", path, lineNo)
+            continue
+        }
+
+        alias := Alias{
+            Source: strings.TrimSpace(line[:idx]),
+            Line:   lineNo,
+        }
+        if alias.Source == "*" {
+            alias.Source = "*@" + domain
+            alias.CatchAll = true
+        } else if !strings.Contains(alias.Source, "@") {
+            alias.Source += "@" + domain
+        }
+        alias.Targets = parseAliasTargets(strings.TrimSpace(line[idx+1:]))
+        for _, t := range alias.Targets {
+            if t.Kind == TargetLocalUser {
+                log.Printf("WARN: %s:%d: %s forwards to the local account %q, which has no address here; "+
+                    "left out on import", path, lineNo, alias.Source, t.Value)
+            }
+        }
+        out.Aliases = append(out.Aliases, alias)
+    }
+    return out, scanner.Err()
+}
+
+// parseAliasTargets splits the right-hand side of a valiases line. A
+// ":fail:" target takes the rest of the line as its message.
+func parseAliasTargets(rhs string) []AliasTarget {
+    var targets []AliasTarget
+    for {
+        rhs = strings.TrimLeft(rhs, ", \t")
+        switch {
+        case rhs == "":
+            return targets
+        case strings.HasPrefix(rhs, ":fail:"):
+            msg := strings.TrimSpace(rhs[len(":fail:"):])
+            return append(targets, AliasTarget{Kind: TargetFail, Value: msg})
+        case strings.HasPrefix(rhs, ":blackhole:"):
+            targets = append(targets, AliasTarget{Kind: TargetBlackhole})
+            rhs = rhs[len(":blackhole:"):]
+        case strings.HasPrefix(rhs, `"`):
+            end := strings.Index(rhs[1:], `"`)
+            if end < 0 {
+                end = len(rhs) - 1
+            }
+            targets = append(targets, aliasTarget(rhs[1:1+end]))
+            rhs = rhs[min(len(rhs), end+2):]
+        case strings.HasPrefix(rhs, "|"):
+            // an unquoted pipe runs to the end of the line
+            return append(targets, aliasTarget(rhs))
+        default:
+            end := strings.IndexAny(rhs, ", \t")
+            if end < 0 {
+                end = len(rhs)
+            }
+            targets = append(targets, aliasTarget(rhs[:end]))
+            rhs = rhs[end:]
+        }
+    }
+}
+
+// aliasTarget classifies one target. A name without "@" is delivered by
+// Exim to the system account of that name (usually the cPanel user's
+// default mailbox), which need not be <name>@<domain>.
+func aliasTarget(s string) AliasTarget {
+    s = strings.TrimSpace(s)
+    if strings.HasPrefix(s, "|") {
+        return AliasTarget{Kind: TargetPipe, Value: strings.TrimSpace(s[1:])}
+    }
+    if !strings.Contains(s, "@") {
+        return AliasTarget{Kind: TargetLocalUser, Value: s}
+    }
+    return AliasTarget{Kind: TargetAddress, Value: s}
+}
+
+// WriteAliases saves aliases.json.
+func WriteAliases(path string, da DomainAliases) error {
+    data, err := json.MarshalIndent(da, "", "  ")
+    if err != nil {
+        return err
+    }
+    return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// ReadAliases loads an aliases.json written by ExportUser.
+func ReadAliases(path string) (DomainAliases, error) {
+    var da DomainAliases
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return da, err
+    }
+    if err := json.Unmarshal(data, &da); err != nil {
+        return da, fmt.Errorf("%s: %w", path, err)
+    }
+    return da, nil
+}
+
+// Matches reports whether the alias is selected by a -mailbox filter
+// (localpart or full address; empty selects everything).
+func (a Alias) Matches(mailbox string) bool {
+    return mailbox == "" || mailbox == a.Source || mailbox == a.LocalPart()
+}
+
+// Actions returns the forwarder as Sieve actions for the alias's own
+// mailbox. Forwards are "unseen" so the mailbox keeps its copy. Local
+// account targets have no address to redirect to and are left out.
+func (a Alias) Actions() []sieve.Action {
+    var acts []sieve.Action
+    for _, t := range a.Targets {
+        switch t.Kind {
+        case TargetAddress:
+            acts = append(acts, sieve.Action{Action: "deliver", Dest: t.Value, Unseen: true})
+        case TargetPipe:
+            acts = append(acts, sieve.Action{Action: "pipe", Dest: t.Value, Unseen: true})
+        case TargetFail:
+            acts = append(acts, sieve.Action{Action: "fail", Dest: ":fail:" + t.Value})
+        case TargetBlackhole:
+            acts = append(acts, sieve.Action{Action: "save", Dest: "/dev/null"})
+        }
+    }
+    return acts
+}
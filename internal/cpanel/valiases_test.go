@@ -0,0 +1,66 @@
+package cpanel
+
+import (
+    "os"
+    "path/filepath"
+    "reflect"
+    "testing"
+)
+
+func TestParseValiases(t *testing.T) {
+    src := `# forwarders
+chris@ex.gr: other@gmail.com, chris2@ex.gr
+info@ex.gr: "|/home/u/bin/ticket.php --queue info", copy@ex.gr
+bot: |/usr/local/bin/bot -q "x, y"
+old@ex.gr: :fail: No such user here, sorry
+spam@ex.gr: :blackhole:
+noline
+*: cpuser
+`
+    path := filepath.Join(t.TempDir(), "ex.gr")
+    if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+        t.Fatal(err)
+    }
+    da, err := ParseValiases(path, "ex.gr")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    want := []Alias{
+        {Source: "chris@ex.gr", Line: 2, Targets: []AliasTarget{
+            {Kind: TargetAddress, Value: "other@gmail.com"},
+            {Kind: TargetAddress, Value: "chris2@ex.gr"},
+        }},
+        {Source: "info@ex.gr", Line: 3, Targets: []AliasTarget{
+            {Kind: TargetPipe, Value: "/home/u/bin/ticket.php --queue info"},
+            {Kind: TargetAddress, Value: "copy@ex.gr"},
+        }},
+        {Source: "bot@ex.gr", Line: 4, Targets: []AliasTarget{
+            {Kind: TargetPipe, Value: `/usr/local/bin/bot -q "x, y"`},
+        }},
+        {Source: "old@ex.gr", Line: 5, Targets: []AliasTarget{
+            {Kind: TargetFail, Value: "No such user here, sorry"},
+        }},
+        {Source: "spam@ex.gr", Line: 6, Targets: []AliasTarget{
+            {Kind: TargetBlackhole},
+        }},
+        {Source: "*@ex.gr", CatchAll: true, Line: 8, Targets: []AliasTarget{
+            {Kind: TargetLocalUser, Value: "cpuser"},
+        }},
+    }
+    if da.Domain != "ex.gr" || !reflect.DeepEqual(da.Aliases, want) {
+        t.Errorf("ParseValiases =\n%+v\nwant\n%+v", da.Aliases, want)
+    }
+}
+
+func TestAliasActions(t *testing.T) {
+    a := Alias{Source: "chris@ex.gr", Targets: []AliasTarget{
+        {Kind: TargetAddress, Value: "other@gmail.com"},
+        {Kind: TargetLocalUser, Value: "cpuser"},
+        {Kind: TargetBlackhole},
+    }}
+    acts := a.Actions()
+    if len(acts) != 2 || acts[0].Action != "deliver" || !acts[0].Unseen || acts[1].Dest != "/dev/null" {
+        t.Errorf("Actions = %+v, want the forward and the discard only", acts)
+    }
+}
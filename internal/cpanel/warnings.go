@@ -0,0 +1,72 @@
+package cpanel
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "log"
+    "sort"
+)
+
+// Diagnostic is a part of a cPanel filter file that was not converted.
+type Diagnostic struct {
+    File   string `json:"file"`
+    Line   int    `json:"line,omitempty"` // 0 when it concerns the whole file
+    Text   string `json:"text,omitempty"` // the source line, trimmed
+    Reason string `json:"reason"`
+}
+
+func (d Diagnostic) String() string {
+    if d.Line == 0 {
+        return fmt.Sprintf("%s: %s", d.File, d.Reason)
+    }
+    return fmt.Sprintf("%s:%d: %s (%s)", d.File, d.Line, d.Reason, d.Text)
+}
+
+// WriteWarnings logs the diagnostics of a mailbox and saves them as a JSON
+// array next to its script. Nothing is written when there are none.
+func WriteWarnings(diags []Diagnostic, where, path string) error {
+    if len(diags) == 0 {
+        return nil
+    }
+    for _, d := range diags {
+        log.Printf("WARN: %s", d)
+    }
+    data, err := json.MarshalIndent(diags, "", "  ")
+    if err != nil {
+        return err
+    }
+    if err := ioutil.WriteFile(path, append(data, '\n'), 0644); err != nil {
+        return fmt.Errorf("write conversion warnings for %s: %w", where, err)
+    }
+    return nil
+}
+
+// warningSummary counts diagnostics per mailbox (or domain) for the end of
+// an export.
+type warningSummary map[string]int
+
+func (s warningSummary) add(where string, diags []Diagnostic) {
+    if len(diags) > 0 {
+        s[where] += len(diags)
+    }
+}
+
+// log prints one line per mailbox with warnings, or nothing.
+func (s warningSummary) log() {
+    if len(s) == 0 {
+        return
+    }
+    var names []string
+    total := 0
+    for where, n := range s {
+        names = append(names, where)
+        total += n
+    }
+    sort.Strings(names)
+    log.Printf("Conversion warnings: %d in %d filter file(s) not converted in full "+
+        "(see conversion-warnings.json / _domain-warnings.json):", total, len(s))
+    for _, where := range names {
+        log.Printf("  %s: %d", where, s[where])
+    }
+}
@@ -0,0 +1,159 @@
+package importer
+
+import (
+    "fmt"
+    "io/ioutil"
+    "log"
+    "os"
+    "path/filepath"
+    "strings"
+
+    "exim2sieve/internal/cpanel"
+    "exim2sieve/internal/sieve"
+)
+
+// ImportAliasesSieve turns the forwarders of aliases.json into redirects in
+// the Sieve script of the forwarding mailbox and uploads the result as
+// cpanel-migrated (the converted filters, if any, follow the redirects).
+// Forwarders without a mailbox on the target and catch-alls cannot be
+// expressed in a user script and are skipped with a warning.
+//
+// Run it after -import-sieve: that mode uploads the filters alone. The
+// domain-wide rules are deployed the same way as there (cfg.DomainScripts).
+func ImportAliasesSieve(cfg ImportConfig) error {
+    if cfg.BackupRoot == "" {
+        return fmt.Errorf("ImportAliasesSieve: BackupRoot is empty")
+    }
+    if len(cfg.DoveadmCmd) == 0 {
+        return fmt.Errorf("ImportAliasesSieve: DoveadmCmd is empty")
+    }
+
+    mode, err := domainScriptsMode(cfg)
+    if err != nil {
+        return err
+    }
+
+    domains, err := ioutil.ReadDir(cfg.BackupRoot)
+    if err != nil {
+        return fmt.Errorf("read BackupRoot: %w", err)
+    }
+
+    imported := 0
+    skipped := 0
+
+    for _, d := range domains {
+        if !d.IsDir() {
+            continue
+        }
+        domain := d.Name()
+        if cfg.Domain != "" && cfg.Domain != domain {
+            continue
+        }
+
+        aliasesPath := filepath.Join(cfg.BackupRoot, domain, "aliases.json")
+        if _, err := os.Stat(aliasesPath); err != nil {
+            continue
+        }
+        da, err := cpanel.ReadAliases(aliasesPath)
+        if err != nil {
+            log.Printf("ERROR: %v", err)
+            continue
+        }
+
+        // The re-uploaded script must keep the domain rules -import-sieve
+        // put in front of the mailbox filters.
+        prefix, err := deployDomainScript(cfg, mode, domain, filepath.Join(cfg.BackupRoot, domain))
+        if err != nil {
+            log.Printf("ERROR: %v", err)
+        }
+
+        for _, alias := range da.Aliases {
+            if !alias.Matches(cfg.Mailbox) {
+                continue
+            }
+            if alias.CatchAll {
+                log.Printf("WARN: catch-all %s cannot be a Sieve redirect, use -aliases-via mailcow", alias.Source)
+                skipped++
+                continue
+            }
+
+            addr := alias.Source
+            exists, err := doveadmUserExists(cfg.DoveadmCmd, addr)
+            if err != nil {
+                log.Printf("ERROR: doveadm user check for %s: %v", addr, err)
+                skipped++
+                continue
+            }
+            if !exists {
+                log.Printf("WARN: forwarder %s has no mailbox on target, use -aliases-via mailcow", addr)
+                skipped++
+                continue
+            }
+
+            for _, t := range alias.Targets {
+                if t.Kind == cpanel.TargetLocalUser {
+                    log.Printf("WARN: forwarder %s: local account %q has no address, left out", addr, t.Value)
+                }
+            }
+            acts := alias.Actions()
+            if len(acts) == 0 {
+                skipped++
+                continue
+            }
+            fwd, report := sieve.ConvertActions("Forwarder", acts, cfg.Sieve)
+            for _, it := range report.Items {
+                log.Printf("REPORT %s: %s", addr, it)
+            }
+
+            scripts := []sieve.SieveScript{fwd}
+            if prefix != nil {
+                scripts = append(scripts, *prefix)
+            }
+            userDir := filepath.Join(cfg.BackupRoot, domain, alias.LocalPart())
+            if sievePath, _, err := findSieveFile(userDir, alias.LocalPart()); err == nil {
+                existing, err := sieve.ReadScript(sievePath)
+                if err != nil {
+                    log.Printf("ERROR: %s: %v", sievePath, err)
+                    skipped++
+                    continue
+                }
+                scripts = append(scripts, existing)
+            }
+            combined := sieve.CombineScripts("cpanel-migrated", scripts)
+            combined = applyDialect(combined, cfg.Sieve, addr)
+
+            if err := lintScript(combined, addr, cfg.Force); err != nil {
+                log.Printf("ERROR: %v", err)
+                skipped++
+                continue
+            }
+
+            if err := doveadmPutData(cfg.DoveadmCmd, addr, "cpanel-migrated", []byte(combined.Content)); err != nil {
+                log.Printf("ERROR: importing forwarders for %s: %v", addr, err)
+                skipped++
+                continue
+            }
+            if err := doveadmActivate(cfg.DoveadmCmd, addr, "cpanel-migrated"); err != nil {
+                log.Printf("WARN: could not activate sieve cpanel-migrated for %s: %v", addr, err)
+            }
+
+            log.Printf("Imported forwarders for %s -> %s", addr, targetsText(alias.Targets))
+            imported++
+        }
+    }
+
+    log.Printf("Alias import completed: imported=%d, skipped=%d", imported, skipped)
+    return nil
+}
+
+func targetsText(targets []cpanel.AliasTarget) string {
+    parts := make([]string, 0, len(targets))
+    for _, t := range targets {
+        if t.Value == "" {
+            parts = append(parts, ":"+t.Kind+":")
+            continue
+        }
+        parts = append(parts, t.Kind+" "+t.Value)
+    }
+    return strings.Join(parts, ", ")
+}
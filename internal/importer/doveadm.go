@@ -9,6 +9,8 @@ import (
     "os/exec"
     "path/filepath"
     "strings"
+
+    "exim2sieve/internal/sieve"
 )
 
 // ImportConfig describes how to import Sieve scripts from a backup.
@@ -22,8 +24,33 @@ type ImportConfig struct {
     // for a unified config object).
     MaildirHostBase, MaildirContainerBase string
 
+    // Force imports scripts even when the offline lint reports errors.
+    Force bool
+
+    // Sieve holds the conversion options for scripts generated at import
+    // time (forwarders).
+    Sieve sieve.Options
+
+    // DomainScripts decides how <domain>/_domain.sieve is deployed (one of
+    // the DomainScripts* constants; empty = inline). GlobalSieveDir is where
+    // "include" and "before" write <domain>.sieve.
+    DomainScripts  string
+    GlobalSieveDir string
+
+    // SOGoToolCmd runs sogo-tool, e.g. {"sogo-tool"} or
+    // {"docker","exec","-i","-u","sogo","ctr","sogo-tool"} (ImportSOGo).
+    SOGoToolCmd []string
 }
 
+// Ways to deploy the domain-wide script (_domain.sieve). Exim runs the
+// domain filter before the mailbox filter, and every mode keeps that order.
+const (
+    DomainScriptsInline  = "inline"  // prepend the rules to every mailbox script
+    DomainScriptsInclude = "include" // install globally, include :global from every mailbox script
+    DomainScriptsBefore  = "before"  // install globally for sieve_before = <dir>/%d.sieve
+    DomainScriptsSkip    = "skip"    // do not deploy
+)
+
 // ImportSieve walks the backup tree and imports Sieve scripts using doveadm.
 // It logs per-user errors but keeps going; returns an error only for fatal
 // issues (e.g. invalid BackupRoot).
@@ -48,6 +75,11 @@ func ImportSieve(cfg ImportConfig) error {
         return fmt.Errorf("read BackupRoot: %w", err)
     }
 
+    mode, err := domainScriptsMode(cfg)
+    if err != nil {
+        return err
+    }
+
     imported := 0
     skipped := 0
 
@@ -67,6 +99,13 @@ func ImportSieve(cfg ImportConfig) error {
             continue
         }
 
+        // Domain-wide rules; prefix is what goes in front of each mailbox
+        // script (nil for before/skip or when there is no _domain.sieve).
+        prefix, err := deployDomainScript(cfg, mode, domain, domainPath)
+        if err != nil {
+            log.Printf("ERROR: %v", err)
+        }
+
         for _, u := range users {
             // Skip non-dirs and special dirs like @pwcache, _domain.filter
             if !u.IsDir() {
@@ -90,12 +129,48 @@ func ImportSieve(cfg ImportConfig) error {
             // Find a .sieve file inside userDir (prefer <user>.sieve)
             sievePath, scriptName, err := findSieveFile(userDir, uname)
 
-            if err != nil {
+            if err != nil && prefix == nil {
                 log.Printf("INFO: no Sieve script for %s: %v", addr, err)
                 skipped++
                 continue
             }
 
+            var data []byte
+            if prefix == nil {
+                if err := lintSieveFile(sievePath, addr, cfg.Force); err != nil {
+                    log.Printf("ERROR: %v", err)
+                    skipped++
+                    continue
+                }
+                if data, err = ioutil.ReadFile(sievePath); err != nil {
+                    log.Printf("ERROR: read sieve file: %v", err)
+                    skipped++
+                    continue
+                }
+            } else {
+                // Domain rules first, then the mailbox's own filters.
+                scripts := []sieve.SieveScript{*prefix}
+                if sievePath != "" {
+                    own, err := sieve.ReadScript(sievePath)
+                    if err != nil {
+                        log.Printf("ERROR: %v", err)
+                        skipped++
+                        continue
+                    }
+                    scripts = append(scripts, own)
+                } else {
+                    sievePath = filepath.Join(domainPath, "_domain.sieve")
+                    scriptName = "cpanel-migrated"
+                }
+                combined := sieve.CombineScripts(scriptName, scripts)
+                combined = applyDialect(combined, cfg.Sieve, addr)
+                if err := lintScript(combined, addr, cfg.Force); err != nil {
+                    log.Printf("ERROR: %v", err)
+                    skipped++
+                    continue
+                }
+                data = []byte(combined.Content)
+            }
 
             exists, err := doveadmUserExists(cfg.DoveadmCmd, addr)
             if err != nil {
@@ -109,7 +184,7 @@ func ImportSieve(cfg ImportConfig) error {
                 continue
             }
 
-            if err := doveadmPut(cfg.DoveadmCmd, addr, scriptName, sievePath); err != nil {
+            if err := doveadmPutData(cfg.DoveadmCmd, addr, scriptName, data); err != nil {
                 log.Printf("ERROR: importing sieve for %s from %s: %v", addr, sievePath, err)
                 skipped++
                 continue
@@ -129,6 +204,84 @@ func ImportSieve(cfg ImportConfig) error {
     return nil
 }
 
+// domainScriptsMode validates cfg.DomainScripts and returns the mode to use.
+func domainScriptsMode(cfg ImportConfig) (string, error) {
+    mode := cfg.DomainScripts
+    if mode == "" {
+        mode = DomainScriptsInline
+    }
+    switch mode {
+    case DomainScriptsInline, DomainScriptsSkip:
+    case DomainScriptsInclude, DomainScriptsBefore:
+        if cfg.GlobalSieveDir == "" {
+            return "", fmt.Errorf("domain scripts mode %q needs [sieve] global_dir", mode)
+        }
+        if mode == DomainScriptsInclude && !cfg.Sieve.Profile.Has("include") {
+            return "", fmt.Errorf("target profile %s has no \"include\" extension, use domain_scripts = inline or before", cfg.Sieve.Profile.Name)
+        }
+    default:
+        return "", fmt.Errorf("unknown domain scripts mode %q (inline, include, before, skip)", mode)
+    }
+    return mode, nil
+}
+
+// deployDomainScript handles <domainPath>/_domain.sieve according to mode.
+// For "inline" it returns the script to put in front of every mailbox script,
+// for "include" the include :global stub; "before" installs the script and
+// returns nil, as Dovecot runs it on its own.
+func deployDomainScript(cfg ImportConfig, mode, domain, domainPath string) (*sieve.SieveScript, error) {
+    path := filepath.Join(domainPath, "_domain.sieve")
+    if mode == DomainScriptsSkip || !fileExists(path) {
+        return nil, nil
+    }
+
+    sc, err := sieve.ReadScript(path)
+    if err != nil {
+        return nil, err
+    }
+    if err := lintScript(sc, domain+" (domain)", cfg.Force); err != nil {
+        return nil, err
+    }
+    if mode == DomainScriptsInline {
+        return &sc, nil
+    }
+
+    // include/before: the script lives on the Dovecot host as <domain>.sieve.
+    if err := os.MkdirAll(cfg.GlobalSieveDir, 0755); err != nil {
+        return nil, fmt.Errorf("mkdir %s: %w", cfg.GlobalSieveDir, err)
+    }
+    dst := filepath.Join(cfg.GlobalSieveDir, domain+".sieve")
+    if err := ioutil.WriteFile(dst, []byte(sc.Content), 0644); err != nil {
+        return nil, fmt.Errorf("write domain script: %w", err)
+    }
+
+    if mode == DomainScriptsBefore {
+        log.Printf("Installed domain script for %s as %s (needs sieve_before = %s/%%d.sieve; compile it with sievec)",
+            domain, dst, cfg.GlobalSieveDir)
+        return nil, nil
+    }
+    log.Printf("Installed domain script for %s as %s (needs sieve_global = %s; compile it with sievec)",
+        domain, dst, cfg.GlobalSieveDir)
+    inc := sieve.IncludeGlobal("Domain "+domain, domain)
+    return &inc, nil
+}
+
+// applyDialect applies the configured output dialect to a script assembled
+// at import time and logs what it could not express.
+func applyDialect(sc sieve.SieveScript, opts sieve.Options, addr string) sieve.SieveScript {
+    report := &sieve.Report{Profile: opts.Profile.Name}
+    sc = sieve.ApplyDialect(sc, opts, report)
+    for _, it := range report.Items {
+        log.Printf("REPORT %s: %s", addr, it)
+    }
+    return sc
+}
+
+func fileExists(path string) bool {
+    fi, err := os.Stat(path)
+    return err == nil && !fi.IsDir()
+}
+
 func findSieveFile(userDir, uname string) (path string, scriptName string, err error) {
     entries, err := ioutil.ReadDir(userDir)
     if err != nil {
@@ -143,9 +296,10 @@ func findSieveFile(userDir, uname string) (path string, scriptName string, err e
         }
     }
 
-    // Otherwise pick the first *.sieve file
+    // Otherwise pick the first *.sieve file; sogo-extra.sieve is uploaded
+    // by -import-sogo and must not become the active script.
     for _, e := range entries {
-        if !e.IsDir() && strings.HasSuffix(e.Name(), ".sieve") {
+        if !e.IsDir() && strings.HasSuffix(e.Name(), ".sieve") && e.Name() != SOGoExtraHook {
             return filepath.Join(userDir, e.Name()), "cpanel-migrated", nil
         }
     }
@@ -153,6 +307,28 @@ func findSieveFile(userDir, uname string) (path string, scriptName string, err e
     return "", "", fmt.Errorf("no .sieve file found in %s", userDir)
 }
 
+// lintSieveFile validates a script offline before it is sent to doveadm,
+// so broken scripts are reported with positions instead of raw stderr.
+func lintSieveFile(sievePath, addr string, force bool) error {
+    data, err := ioutil.ReadFile(sievePath)
+    if err != nil {
+        return fmt.Errorf("read sieve file: %w", err)
+    }
+    return lintScript(sieve.SieveScript{Name: sievePath, Content: string(data)}, addr, force)
+}
+
+// lintScript is lintSieveFile for scripts assembled at import time.
+func lintScript(sc sieve.SieveScript, addr string, force bool) error {
+    findings := sieve.Lint(sc)
+    for _, f := range findings {
+        log.Printf("LINT %s: %s", addr, f)
+    }
+    if sieve.HasErrors(findings) && !force {
+        return fmt.Errorf("%s has lint errors, not importing for %s (use -force to import anyway)", sc.Name, addr)
+    }
+    return nil
+}
+
 func doveadmUserExists(doveadmCmd []string, addr string) (bool, error) {
     args := append(doveadmCmd[1:], "user", "-u", addr)
     cmd := exec.Command(doveadmCmd[0], args...)
@@ -166,12 +342,8 @@ func doveadmUserExists(doveadmCmd []string, addr string) (bool, error) {
     return true, nil
 }
 
-func doveadmPut(doveadmCmd []string, addr, scriptName, sievePath string) error {
-    data, err := ioutil.ReadFile(sievePath)
-    if err != nil {
-        return fmt.Errorf("read sieve file: %w", err)
-    }
-
+// doveadmPutData uploads a script given as text.
+func doveadmPutData(doveadmCmd []string, addr, scriptName string, data []byte) error {
     args := append(doveadmCmd[1:], "sieve", "put", "-u", addr, scriptName)
     cmd := exec.Command(doveadmCmd[0], args...)
     cmd.Stdin = bytes.NewReader(data)
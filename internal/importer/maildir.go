@@ -8,6 +8,8 @@ import (
     "os/exec"
     "path/filepath"
     "strings"
+
+    "exim2sieve/internal/sieve"
 )
 
 // ImportMaildir walks the backup tree and imports Maildir contents using doveadm import.
@@ -95,6 +97,8 @@ func ImportMaildir(cfg ImportConfig) error {
                 continue
             }
 
+            reportMaildirFolders(cfg, addr, maildirPath)
+
             if err := doveadmImportMaildir(cfg, addr, maildirPath); err != nil {
                 log.Printf("ERROR: importing maildir for %s from %s: %v", addr, maildirPath, err)
                 skipped++
@@ -110,6 +114,49 @@ func ImportMaildir(cfg ImportConfig) error {
     return nil
 }
 
+// reportMaildirFolders logs the Maildir++ folders of a mailbox under the
+// names the converted filters use (sieve.MaildirFolder: modified UTF-7
+// decoded, hierarchy separator of the target). doveadm import does the
+// same translation, but does not know the [folders] rename map, so renamed
+// folders are listed with the command that moves them.
+func reportMaildirFolders(cfg ImportConfig, addr, maildirPath string) {
+    entries, err := os.ReadDir(maildirPath)
+    if err != nil {
+        return
+    }
+    plain := sieve.Options{FolderSeparator: cfg.Sieve.FolderSeparator}
+
+    var names []string
+    for _, e := range entries {
+        if !e.IsDir() || !strings.HasPrefix(e.Name(), ".") || strings.Trim(e.Name(), ".") == "" {
+            continue
+        }
+        for _, level := range strings.Split(strings.TrimPrefix(e.Name(), "."), ".") {
+            if _, err := sieve.DecodeModifiedUTF7(level); err != nil {
+                log.Printf("WARN: %s: folder %q: %v", addr, e.Name(), err)
+            }
+        }
+        imported := sieve.MaildirFolder(e.Name(), plain)
+        name := sieve.MaildirFolder(e.Name(), cfg.Sieve)
+        // Renaming a parent moves its subfolders along.
+        parent := e.Name()
+        if i := strings.LastIndex(parent, "."); i > 0 {
+            parent = parent[:i]
+        }
+        if name != imported && (parent == e.Name() || sieve.MaildirFolder(parent, cfg.Sieve) == sieve.MaildirFolder(parent, plain)) {
+            log.Printf("WARN: %s: folder %q is %q in the filters; after the import run: doveadm mailbox rename -u %s %q %q",
+                addr, imported, name, addr, imported, name)
+        }
+        if name != strings.TrimPrefix(e.Name(), ".") {
+            name += " (" + e.Name() + ")"
+        }
+        names = append(names, name)
+    }
+    if len(names) > 0 {
+        log.Printf("INFO: folders for %s: %s", addr, strings.Join(names, ", "))
+    }
+}
+
 func isDir(path string) (bool, error) {
     fi, err := os.Stat(path)
     if err != nil {
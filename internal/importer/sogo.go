@@ -0,0 +1,187 @@
+package importer
+
+import (
+    "bytes"
+    "fmt"
+    "io/ioutil"
+    "log"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "strings"
+
+    "exim2sieve/internal/sieve"
+)
+
+// SOGoExtraScript is the personal script name sogo-extra.sieve is uploaded
+// as. It is not activated: SOGo owns the active script.
+const SOGoExtraScript = "cpanel-extra"
+
+// SOGoExtraHook is the global script, installed in GlobalSieveDir, that
+// runs SOGoExtraScript of every user (sieve_after = <dir>/sogo-extra.sieve).
+const SOGoExtraHook = "sogo-extra.sieve"
+
+// ImportSOGo loads each mailbox's sogo-filters.json into SOGo's user
+// defaults (SOGoSieveFilters) with sogo-tool, and uploads sogo-extra.sieve
+// as the inactive personal script SOGoExtraScript.
+//
+// SOGo only rewrites the active Sieve script when the user saves filters in
+// its UI, so the script from -import-sieve keeps running until then; after
+// that the extra script only runs through the SOGoExtraHook installed in
+// GlobalSieveDir. Mailboxes with an extra script are skipped, and an error
+// returned, when GlobalSieveDir is not configured.
+func ImportSOGo(cfg ImportConfig) error {
+    if cfg.BackupRoot == "" {
+        return fmt.Errorf("ImportSOGo: BackupRoot is empty")
+    }
+    if len(cfg.SOGoToolCmd) == 0 {
+        return fmt.Errorf("ImportSOGo: SOGoToolCmd is empty")
+    }
+
+    domains, err := ioutil.ReadDir(cfg.BackupRoot)
+    if err != nil {
+        return fmt.Errorf("read BackupRoot: %w", err)
+    }
+
+    imported := 0
+    skipped := 0
+    extras := 0
+    var noHook []string
+    hookInstalled := false
+
+    for _, d := range domains {
+        if !d.IsDir() {
+            continue
+        }
+        domain := d.Name()
+        if cfg.Domain != "" && cfg.Domain != domain {
+            continue
+        }
+
+        domainPath := filepath.Join(cfg.BackupRoot, domain)
+        users, err := ioutil.ReadDir(domainPath)
+        if err != nil {
+            log.Printf("WARN: cannot read domain dir %s: %v", domainPath, err)
+            continue
+        }
+
+        for _, u := range users {
+            uname := u.Name()
+            if !u.IsDir() || strings.HasPrefix(uname, "@") || strings.HasPrefix(uname, "_") {
+                continue
+            }
+            addr := uname + "@" + domain
+            if cfg.Mailbox != "" && cfg.Mailbox != addr && cfg.Mailbox != uname {
+                continue
+            }
+
+            userDir := filepath.Join(domainPath, uname)
+            filtersPath := filepath.Join(userDir, "sogo-filters.json")
+            extraPath := filepath.Join(userDir, "sogo-extra.sieve")
+            hasFilters, hasExtra := fileExists(filtersPath), fileExists(extraPath)
+            if !hasFilters && !hasExtra {
+                continue
+            }
+            if hasExtra && cfg.GlobalSieveDir == "" {
+                // Once the user saves in SOGo, nothing would run the extra
+                // filters any more.
+                log.Printf("ERROR: %s has filters SOGo cannot hold (%s) but [sieve] global_dir is not set "+
+                    "for the %s hook; SOGo filters not imported", addr, extraPath, SOGoExtraHook)
+                noHook = append(noHook, addr)
+                skipped++
+                continue
+            }
+
+            // A mailbox with only an autoresponder has no SOGo filters.
+            if hasFilters {
+                data, err := ioutil.ReadFile(filtersPath)
+                if err != nil {
+                    log.Printf("ERROR: %v", err)
+                    skipped++
+                    continue
+                }
+                if err := sogoToolSetFilters(cfg.SOGoToolCmd, addr, data); err != nil {
+                    log.Printf("ERROR: SOGo filters for %s: %v", addr, err)
+                    skipped++
+                    continue
+                }
+                log.Printf("Imported SOGo filters for %s from %s", addr, filtersPath)
+                imported++
+            }
+
+            if !hasExtra {
+                continue
+            }
+            if len(cfg.DoveadmCmd) == 0 {
+                log.Printf("WARN: no doveadm command, %s not uploaded", extraPath)
+                continue
+            }
+            if err := lintSieveFile(extraPath, addr, cfg.Force); err != nil {
+                log.Printf("ERROR: %v", err)
+                continue
+            }
+            extra, err := ioutil.ReadFile(extraPath)
+            if err != nil {
+                log.Printf("ERROR: read sieve file: %v", err)
+                continue
+            }
+            if err := doveadmPutData(cfg.DoveadmCmd, addr, SOGoExtraScript, extra); err != nil {
+                log.Printf("ERROR: importing %s for %s: %v", extraPath, addr, err)
+                continue
+            }
+            log.Printf("Uploaded %s for %s as %s (inactive)", extraPath, addr, SOGoExtraScript)
+            extras++
+
+            if !hookInstalled {
+                if err := installSOGoHook(cfg.GlobalSieveDir); err != nil {
+                    return err
+                }
+                hookInstalled = true
+            }
+        }
+    }
+
+    log.Printf("SOGo import completed: imported=%d, skipped=%d, extra scripts=%d", imported, skipped, extras)
+    if len(noHook) > 0 {
+        return fmt.Errorf("%d mailbox(es) not imported because their %s script would not run: %s "+
+            "(set [sieve] global_dir to install the %s hook)",
+            len(noHook), SOGoExtraScript, strings.Join(noHook, ", "), SOGoExtraHook)
+    }
+    return nil
+}
+
+// installSOGoHook writes the global script that includes every user's
+// SOGoExtraScript. It has to be configured as sieve_after, which runs
+// after the active (SOGo) script unless that one stops.
+func installSOGoHook(dir string) error {
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return fmt.Errorf("mkdir %s: %w", dir, err)
+    }
+    inc := sieve.NewCommand("include", sieve.Tag("personal"), sieve.Tag("optional"), sieve.String(SOGoExtraScript))
+    inc.Comments = []string{"Filters SOGo cannot hold, uploaded by exim2sieve -import-sogo"}
+    hook := sieve.NewSieveScript(SOGoExtraHook, &sieve.Script{Commands: []*sieve.Command{
+        sieve.NewCommand("require", sieve.StringList{"include"}),
+        inc,
+    }})
+    dst := filepath.Join(dir, SOGoExtraHook)
+    if err := ioutil.WriteFile(dst, []byte(hook.Content), 0644); err != nil {
+        return fmt.Errorf("write %s: %w", dst, err)
+    }
+    log.Printf("Installed %s (needs sieve_after = %s; compile it with sievec)", dst, dst)
+    return nil
+}
+
+// sogoToolSetFilters stores a {"SOGoSieveFilters": [...]} document as the
+// user's SOGoSieveFilters default.
+func sogoToolSetFilters(sogoToolCmd []string, addr string, data []byte) error {
+    args := append(sogoToolCmd[1:], "user-preferences", "set", "defaults", addr, "SOGoSieveFilters", "-f", "/dev/stdin")
+    cmd := exec.Command(sogoToolCmd[0], args...)
+    cmd.Stdin = bytes.NewReader(data)
+    var out bytes.Buffer
+    cmd.Stderr = &out
+
+    if err := cmd.Run(); err != nil {
+        return fmt.Errorf("sogo-tool user-preferences set failed: %v, stderr=%s", err, out.String())
+    }
+    return nil
+}
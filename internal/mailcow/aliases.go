@@ -0,0 +1,159 @@
+package mailcow
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"exim2sieve/internal/cpanel"
+)
+
+// CreateAlias creates a mailcow alias. goto lists the target addresses;
+// discard drops the mail instead (goto_null). A catch-all is "@domain".
+// "Already exists" is logged and not treated as an error.
+func (c *Client) CreateAlias(address string, gotos []string, discard bool) error {
+	endpoint := c.apiURL + "/add/alias"
+
+	payload := map[string]interface{}{
+		"address": address,
+		"goto":    strings.Join(gotos, ","),
+		"active":  "1",
+	}
+	if discard {
+		payload["goto_null"] = "1"
+		delete(payload, "goto")
+	}
+
+	respBody, status, err := c.postJSON(endpoint, payload)
+	if err != nil {
+		return fmt.Errorf("CreateAlias %s: %w", address, err)
+	}
+	if status/100 != 2 {
+		return fmt.Errorf("CreateAlias %s: HTTP %d: %s", address, status, string(respBody))
+	}
+
+	resp, _ := parseMailcowResponse(respBody)
+	if resp == nil || resp.Type == "" {
+		log.Printf("mailcow: add/alias %s raw response: %s", address, string(respBody))
+		return nil
+	}
+
+	msgJoined := joinMsg(resp.Msg)
+	switch resp.Type {
+	case "success":
+		return nil
+	case "danger", "error":
+		if strings.Contains(msgJoined, "exist") {
+			log.Printf("mailcow: alias %s already exists (%s)", address, msgJoined)
+			return nil
+		}
+		return fmt.Errorf("CreateAlias %s failed: type=%s msg=%s body=%s",
+			address, resp.Type, msgJoined, string(respBody))
+	default:
+		log.Printf("mailcow: add/alias %s returned unknown type=%s msg=%s body=%s",
+			address, resp.Type, msgJoined, string(respBody))
+		return nil
+	}
+}
+
+// CreateAliasesFromBackup creates mailcow aliases from the aliases.json
+// files of a backup tree (as produced by -cpanel-user). Catch-alls become
+// "@domain" aliases. mailcow aliases can only forward or drop mail, so
+// pipe, :fail: and local account targets are logged and left out. A
+// forwarder of an existing mailbox also delivers to the mailbox itself.
+//
+// domainFilter and mailboxFilter limit the run like in the other modes.
+func CreateAliasesFromBackup(c *Client, backupRoot, domainFilter, mailboxFilter string, logWriter io.Writer) error {
+	if logWriter == nil {
+		logWriter = os.Stdout
+	}
+	logger := log.New(logWriter, "", log.LstdFlags)
+
+	entries, err := os.ReadDir(backupRoot)
+	if err != nil {
+		return fmt.Errorf("read backup root %s: %w", backupRoot, err)
+	}
+
+	for _, ent := range entries {
+		if !ent.IsDir() {
+			continue
+		}
+		domain := ent.Name()
+		if domainFilter != "" && domain != domainFilter {
+			continue
+		}
+
+		aliasesPath := filepath.Join(backupRoot, domain, "aliases.json")
+		if _, err := os.Stat(aliasesPath); err != nil {
+			continue
+		}
+		da, err := cpanel.ReadAliases(aliasesPath)
+		if err != nil {
+			logger.Printf("mailcow: %v", err)
+			continue
+		}
+
+		for _, alias := range da.Aliases {
+			if !alias.Matches(mailboxFilter) {
+				continue
+			}
+
+			address := alias.Source
+			if alias.CatchAll {
+				address = "@" + domain
+			}
+
+			// cPanel still delivers to the mailbox of a forwarded address;
+			// a mailcow alias replaces that delivery unless it lists it.
+			mailbox := !alias.CatchAll && dirExists(filepath.Join(backupRoot, domain, alias.LocalPart()))
+
+			var gotos []string
+			discard := false
+			for _, t := range alias.Targets {
+				switch t.Kind {
+				case cpanel.TargetAddress:
+					gotos = append(gotos, t.Value)
+				case cpanel.TargetBlackhole:
+					discard = true
+				default:
+					logger.Printf("mailcow: alias %s: %s target %q is not supported by mailcow aliases, skipped",
+						alias.Source, t.Kind, t.Value)
+				}
+			}
+			if len(gotos) == 0 && !discard {
+				continue
+			}
+			if mailbox {
+				if len(gotos) == 0 {
+					logger.Printf("mailcow: alias %s: :blackhole: on a mailbox is not migrated, the mailbox keeps its mail", alias.Source)
+					continue
+				}
+				gotos = append(gotos, alias.Source)
+			}
+			if discard && len(gotos) > 0 {
+				logger.Printf("mailcow: alias %s mixes :blackhole: with addresses; forwarding only", alias.Source)
+				discard = false
+			}
+
+			if err := c.CreateAlias(address, gotos, discard); err != nil {
+				logger.Printf("mailcow: create alias %s: %v", address, err)
+				continue
+			}
+			if discard {
+				logger.Printf("mailcow: created alias %s -> :blackhole:", address)
+				continue
+			}
+			logger.Printf("mailcow: created alias %s -> %s", address, strings.Join(gotos, ","))
+		}
+	}
+
+	return nil
+}
+
+func dirExists(path string) bool {
+	st, err := os.Stat(path)
+	return err == nil && st.IsDir()
+}
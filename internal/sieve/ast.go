@@ -0,0 +1,141 @@
+package sieve
+
+// Pos is a 1-based line/column position inside a Sieve source text.
+// Nodes built by the converter carry a zero Pos.
+type Pos struct {
+    Line   int
+    Column int
+}
+
+// Script is a Sieve syntax tree: an ordered list of top-level commands.
+type Script struct {
+    Commands []*Command
+}
+
+// Command is a single Sieve command (require, if, fileinto, stop, ...).
+//
+// Control commands (if/elsif/else) keep their condition in Test and their
+// body in Block. A Command with an empty Name only carries Comments and is
+// printed as a block of "# ..." lines.
+type Command struct {
+    Name     string
+    Args     []Arg
+    Test     *Test
+    Block    []*Command
+    Comments []string // leading hash comments, without the "# " prefix
+    Pos      Pos
+}
+
+// Test is a Sieve test. allof/anyof/not keep their operands in Tests.
+type Test struct {
+    Name    string
+    Args    []Arg
+    Tests   []*Test
+    Comment string // printed as a trailing /* ... */ comment
+    // LeadingComment is a bracket comment before the test, as in
+    // "anyof (/* note */ header ...)".
+    LeadingComment string
+    // LineComment is a hash comment after the test of an if/elsif, which
+    // pushes the opening brace to the next line (Roundcube's disabled rules:
+    // "if false # <original test>").
+    LineComment string
+    Pos         Pos
+}
+
+// Arg is a positional or tagged argument of a command or test.
+type Arg interface {
+    isArg()
+}
+
+// Tag is a tagged argument such as :is or :contains (stored without the colon).
+type Tag string
+
+// String is a single string argument.
+type String string
+
+// StringList is a bracketed string list: ["a", "b"].
+type StringList []string
+
+// Number is a numeric argument with an optional K/M/G quantifier.
+type Number struct {
+    Value      uint64
+    Quantifier string
+}
+
+func (Tag) isArg()        {}
+func (String) isArg()     {}
+func (StringList) isArg() {}
+func (Number) isArg()     {}
+
+// NewCommand builds a simple command such as fileinto "X" or stop.
+func NewCommand(name string, args ...Arg) *Command {
+    return &Command{Name: name, Args: args}
+}
+
+// NewTest builds a simple test such as header :contains "Subject" "x".
+func NewTest(name string, args ...Arg) *Test {
+    return &Test{Name: name, Args: args}
+}
+
+// CommentBlock builds a comment-only command.
+func CommentBlock(lines ...string) *Command {
+    return &Command{Comments: lines}
+}
+
+// IsComment reports whether the command only carries comments.
+func (c *Command) IsComment() bool {
+    return c.Name == ""
+}
+
+// HasBlock reports whether the command is printed with a { ... } body.
+func (c *Command) HasBlock() bool {
+    switch c.Name {
+    case "if", "elsif", "else":
+        return true
+    }
+    return c.Block != nil
+}
+
+// Requires returns the extensions listed in all require commands of the
+// script, in order of appearance and without duplicates.
+func (s *Script) Requires() []string {
+    seen := map[string]bool{}
+    var out []string
+    for _, c := range s.Commands {
+        if c.Name != "require" {
+            continue
+        }
+        for _, a := range c.Args {
+            for _, ext := range ArgStrings(a) {
+                if !seen[ext] {
+                    seen[ext] = true
+                    out = append(out, ext)
+                }
+            }
+        }
+    }
+    return out
+}
+
+// Body returns the top-level commands of the script except require.
+func (s *Script) Body() []*Command {
+    var out []*Command
+    for _, c := range s.Commands {
+        if c.Name == "require" {
+            continue
+        }
+        out = append(out, c)
+    }
+    return out
+}
+
+// ArgStrings returns the strings held by a String or StringList argument.
+func ArgStrings(a Arg) []string {
+    switch v := a.(type) {
+    case String:
+        return []string{string(v)}
+    case StringList:
+        return []string(v)
+    }
+    return nil
+}
@@ -2,7 +2,6 @@ package sieve
 
 import (
     "fmt"
-    "sort"
     "strings"
 )
 // sanitizeRuleName καθαρίζει το όνομα του φίλτρου ώστε να είναι ασφαλές
@@ -27,81 +26,118 @@ func sanitizeRuleName(name string) string {
 
 // CombineScripts merges many SieveScript objects into a single script:
 //
-// - Deduplicates all "require [...]" lines and moves them to the top.
+// - Merges the require lists of all scripts into one require at the top.
 // - Keeps all the IF blocks from each filter, separated by comments.
 func CombineScripts(name string, scripts []SieveScript) SieveScript {
     reqSet := map[string]bool{}
-    var bodyChunks []string
+    seenPrelude := map[string]bool{}
+    var body []*Command
 
     for _, sc := range scripts {
-        lines := strings.Split(sc.Content, "\n")
-        var filtered []string
-
-        for _, line := range lines {
-            trimmed := strings.TrimSpace(line)
-
-            if strings.HasPrefix(trimmed, "require [") {
-                // Parse inside brackets: require ["fileinto", "reject"];
-                start := strings.Index(trimmed, "[")
-                end := strings.Index(trimmed, "]")
-                if start != -1 && end != -1 && end > start {
-                    inner := trimmed[start+1 : end]
-                    parts := strings.Split(inner, ",")
-                    for _, p := range parts {
-                        m := strings.TrimSpace(p)
-                        m = strings.Trim(m, `"`) // strip quotes
-                        if m != "" {
-                            reqSet[m] = true
-                        }
-                    }
-                }
-                continue // drop this require from the body
+        tree := sc.Script
+        if tree == nil {
+            // Scripts read from disk may only carry text; parse it so the
+            // merge stays structural.
+            parsed, err := ParseScript(sc.Content)
+            if err != nil {
+                lines := []string{fmt.Sprintf("NOTE: could not parse script %s: %v", sc.Name, err)}
+                lines = append(lines, strings.Split(strings.TrimRight(sc.Content, "\n"), "\n")...)
+                parsed = &Script{Commands: []*Command{CommentBlock(lines...)}}
             }
+            tree = parsed
+        }
 
-            filtered = append(filtered, line)
+        for _, ext := range tree.Requires() {
+            reqSet[ext] = true
+        }
+
+        // Variable preludes (if ... { set ...; }) are identical across
+        // filters; the first one sets the variables for all later rules.
+        var cmds []*Command
+        for _, cmd := range tree.Body() {
+            if key, ok := setPreludeKey(cmd); ok {
+                if seenPrelude[key] {
+                    continue
+                }
+                seenPrelude[key] = true
+            }
+            cmds = append(cmds, cmd)
         }
 
         // Skip completely empty bodies
-        content := strings.TrimSpace(strings.Join(filtered, "\n"))
-        if content == "" {
+        if len(cmds) == 0 {
             continue
         }
 
-        // Roundcube-compatible rule name:
+        // Scripts combined before (e.g. an exported mailbox script read back)
+        // already name their rules.
+        if hasRuleName(cmds[0]) {
+            body = append(body, cmds...)
+            continue
+        }
 
         safeName := sanitizeRuleName(sc.Name)
 
-        // Roundcube-compatible rule name:
-        bodyChunks = append(bodyChunks, fmt.Sprintf("# rule:[%s]", safeName))
-        // name as it was in comment
-        bodyChunks = append(bodyChunks, fmt.Sprintf("# Filter: %s", safeName))
+        // Roundcube-compatible rule name, plus the name as it was in comment.
+        // Copy the first command so the source script is left untouched.
+        first := *cmds[0]
+        first.Comments = append([]string{
+            fmt.Sprintf("rule:[%s]", safeName),
+            fmt.Sprintf("Filter: %s", safeName),
+        }, first.Comments...)
 
-        bodyChunks = append(bodyChunks, content)
-        bodyChunks = append(bodyChunks, "") // blank line between filters
+        body = append(body, &first)
+        body = append(body, cmds[1:]...)
     }
 
-    var b strings.Builder
+    combined := &Script{}
 
     // Top-level require header
     if len(reqSet) > 0 {
-        var mods []string
-        for m := range reqSet {
-            mods = append(mods, fmt.Sprintf("%q", m))
-        }
-        sort.Strings(mods)
-
-        b.WriteString("require [")
-        b.WriteString(strings.Join(mods, ", "))
-        b.WriteString("];\n\n")
+        combined.Commands = append(combined.Commands, requireCommand(reqSet))
     }
 
     // All filter bodies one after another
-    if len(bodyChunks) > 0 {
-        b.WriteString(strings.Join(bodyChunks, "\n"))
+    combined.Commands = append(combined.Commands, body...)
+
+    return NewSieveScript(name, combined)
+}
+
+// setPreludeKey reports whether cmd only assigns variables and returns its
+// text without comments, so equal preludes can be recognised.
+func setPreludeKey(cmd *Command) (string, bool) {
+    if cmd.Name != "if" || len(cmd.Block) == 0 {
+        return "", false
+    }
+    for _, c := range cmd.Block {
+        if c.Name != "set" {
+            return "", false
+        }
     }
+    bare := *cmd
+    bare.Comments = nil
+    return (&Script{Commands: []*Command{&bare}}).String(), true
+}
 
-    return SieveScript{
-        Name:    name,
-        Content: b.String(),
+// hasRuleName reports whether cmd already carries a "# rule:[...]" comment.
+func hasRuleName(cmd *Command) bool {
+    for _, c := range cmd.Comments {
+        if strings.HasPrefix(c, "rule:[") {
+            return true
+        }
     }
+    return false
+}
+
+// IncludeGlobal returns a script that runs the global script global (found
+// in the server's sieve_global location) at this point via include :global.
+// A stop inside the included script ends the whole execution, as it would
+// have inline.
+func IncludeGlobal(name, global string) SieveScript {
+    inc := NewCommand("include", Tag("global"), String(global))
+    inc.Comments = []string{"Domain-wide rules, installed globally as " + global + ".sieve"}
+    return NewSieveScript(name, &Script{Commands: []*Command{
+        NewCommand("require", StringList{"include"}),
+        inc,
+    }})
 }
@@ -6,359 +6,734 @@ import (
     "strings"
 )
 
-// SieveScript represents a single output sieve file
+// SieveScript represents a single output sieve file. Content is the
+// rendered text of Script.
 type SieveScript struct {
     Name    string
     Content string
+    Script  *Script
+}
+
+// Options controls how filters are converted.
+type Options struct {
+    // Profile is the target server; extensions it lacks are avoided.
+    Profile Profile
+
+    // PipeCommands maps Exim pipe commands (full command line or just the
+    // program path) to the program name, plus optional fixed arguments,
+    // that sieve_pipe_bin_dir offers on the target.
+    PipeCommands map[string]string
+
+    // QuarantineFolder receives messages Exim would "freeze" (hold in the
+    // queue for the admin). Empty means DefaultQuarantineFolder.
+    QuarantineFolder string
+
+    // DisabledFilters is how filters disabled in cPanel are written:
+    // DisabledComment (default) or DisabledRoundcube.
+    DisabledFilters string
+
+    // Dialect is the output layout, see ApplyDialect. DialectRoundcube
+    // implies DisabledRoundcube.
+    Dialect string
+
+    // FolderSeparator is the hierarchy separator of the target's mail
+    // namespace. Empty means DefaultFolderSeparator.
+    FolderSeparator string
+
+    // FolderMap renames folders of save paths, see MaildirFolder. Keys are
+    // cPanel folder names ("INBOX.Sent" or "Sent"), values target names.
+    FolderMap map[string]string
+
+    // AnyRecipient is what cPanel's "any recipient" tests: RecipientHeaders
+    // (default, To/Cc/Bcc) or RecipientEnvelope (the SMTP recipient).
+    AnyRecipient string
+
+    // SpamHeaders rewrites conditions on SpamAssassin headers for the
+    // target's spam filter. Keys are lower-case source header names.
+    SpamHeaders map[string]SpamRewrite
+}
+
+// Ways to write disabled filters.
+const (
+    DisabledComment   = "comment"   // the whole rule as hash comments
+    DisabledRoundcube = "roundcube" // "if false # <test>", switchable in Roundcube
+)
+
+// What "any recipient" tests (Options.AnyRecipient).
+const (
+    RecipientHeaders  = "headers"  // address :contains ["To", "Cc", "Bcc"]
+    RecipientEnvelope = "envelope" // envelope "to", who the message is delivered to
+)
+
+// defaultRejectMessage is used when a fail/reject action carries no text.
+const defaultRejectMessage = "Message rejected by filter"
+
+// DefaultQuarantineFolder is where frozen messages are filed by default.
+const DefaultQuarantineFolder = "Quarantine"
+
+// DefaultOptions converts for the default (Pigeonhole) profile.
+func DefaultOptions() Options {
+    p, _ := ResolveProfile(DefaultProfileName, nil, 0)
+    return Options{Profile: p}
 }
 
 // ConvertFilters converts cPanel/Exim YAML filters into Sieve scripts.
-func ConvertFilters(f Filter) []SieveScript {
+// The report lists every place where the target profile forced a
+// different (or lossy) construct.
+func ConvertFilters(f Filter, opts Options) ([]SieveScript, *Report) {
+    if opts.Profile.Extensions == nil {
+        opts.Profile = DefaultOptions().Profile
+    }
+    report := &Report{Profile: opts.Profile.Name}
     var scripts []SieveScript
 
     for _, flt := range f.Filter {
+        c := &converter{
+            opts:   opts,
+            report: report,
+            filter: flt.Filtername,
+            used:   map[string]bool{},
+        }
+        script := c.entry(flt)
+
+        // If the filter was disabled in cPanel, keep it but make sure it
+        // does not run on the target system.
+        roundcube := opts.DisabledFilters == DisabledRoundcube || opts.Dialect == DialectRoundcube
+        if flt.Enabled == 0 && roundcube {
+            disableRule(script)
+        } else if flt.Enabled == 0 {
+            script = commentOut(script,
+                fmt.Sprintf("NOTE: this filter was disabled in cPanel (enabled=%d)", flt.Enabled),
+            )
+        }
 
-        var sb strings.Builder
-        usedExt := map[string]bool{}
-        usesBody := false
-
-        // ── Build combined condition from all rules ────────────────────────
-if len(flt.Rules) == 0 {
-    sb.WriteString(" # Filter has no rules; nothing to match.\n")
+        scripts = append(scripts, NewSieveScript(flt.Filtername, script))
+    }
 
-    content := sb.String()
+    return scripts, report
+}
 
-    // If the filter was disabled in cPanel, keep it but comment it out
-    // so it does not run on the target system.
-    if flt.Enabled == 0 {
-        var commentedLines []string
-        commentedLines = append(commentedLines,
-            fmt.Sprintf("# NOTE: this filter was disabled in cPanel (enabled=%d)", flt.Enabled),
-        )
-        for _, line := range strings.Split(content, "\n") {
-            if strings.TrimSpace(line) == "" {
-                commentedLines = append(commentedLines, "")
-            } else {
-                commentedLines = append(commentedLines, "# "+line)
-            }
+// ConvertActions builds a script that runs actions unconditionally, e.g.
+// the targets of a cPanel forwarder. Unless every action is "unseen", the
+// script stops afterwards like a filter that matched.
+func ConvertActions(name string, actions []Action, opts Options) (SieveScript, *Report) {
+    if opts.Profile.Extensions == nil {
+        opts.Profile = DefaultOptions().Profile
+    }
+    report := &Report{Profile: opts.Profile.Name}
+    c := &converter{opts: opts, report: report, filter: name, used: map[string]bool{}}
+
+    cmds := c.actions(actions)
+    for _, a := range actions {
+        if !a.Unseen {
+            cmds = append(cmds, NewCommand("stop"))
+            break
         }
-        content = strings.Join(commentedLines, "\n")
     }
+    c.checkRedirects(cmds)
 
-    scripts = append(scripts, SieveScript{
-        Name:    flt.Filtername,
-        Content: content,
-    })
-    continue
+    script := &Script{}
+    if len(c.used) > 0 {
+        script.Commands = append(script.Commands, requireCommand(c.used))
+    }
+    if c.addrVars {
+        script.Commands = append(script.Commands, addressVariablesPrelude())
+    }
+    script.Commands = append(script.Commands, cmds...)
+    return NewSieveScript(name, script), report
 }
 
+// NewSieveScript wraps a syntax tree into a SieveScript, rendering Content
+// with the canonical printer.
+func NewSieveScript(name string, script *Script) SieveScript {
+    return SieveScript{
+        Name:    name,
+        Content: script.String(),
+        Script:  script,
+    }
+}
 
+// converter holds the state of converting one filter entry.
+type converter struct {
+    opts   Options
+    report *Report
+    filter string
+    used   map[string]bool // extensions the script requires
 
-        cond, condUsesBody := buildConditions(flt.Rules)
-        if condUsesBody {
-            usesBody = true
-        }
+    // addrVars is set when a value refers to $local_part / $domain and the
+    // variables prelude must be emitted.
+    addrVars bool
 
-        // ── Determine required Sieve extensions from actions & body ──────
-        if usesBody {
-            usedExt["body"] = true
-        }
+    // notes are comment lines for the filter's if, e.g. spam header
+    // rewrites.
+    notes []string
+}
+
+// degrade records that ext is missing on the target profile.
+func (c *converter) degrade(ext, format string, args ...interface{}) {
+    c.report.add(c.filter, ReportDegraded, ext, format, args...)
+}
+
+// entry builds the syntax tree for a single cPanel filter entry.
+func (c *converter) entry(flt FilterEntry) *Script {
+    script := &Script{}
+
+    // ── Build combined condition from all rules ────────────────────────
+    if len(flt.Rules) == 0 && len(flt.Actions) == 0 {
+        script.Commands = append(script.Commands,
+            CommentBlock("Filter has no rules; nothing to match."),
+        )
+        return script
+    }
+    if len(flt.Rules) == 0 {
+        // Exim filter commands outside any if run for every message.
+        cmds := c.actions(flt.Actions)
         for _, a := range flt.Actions {
-            switch strings.ToLower(strings.TrimSpace(a.Action)) {
-            case "save", "deliver":
-                usedExt["fileinto"] = true
-            case "reject":
-                usedExt["reject"] = true
+            if !a.Unseen {
+                cmds = append(cmds, NewCommand("stop"))
+                break
             }
         }
-
-        // ── require [...] header ──────────────────────────────────────────
-        if len(usedExt) > 0 {
-            var reqs []string
-            for k := range usedExt {
-                reqs = append(reqs, fmt.Sprintf("%q", k))
-            }
-            sort.Strings(reqs)
-            sb.WriteString("require [")
-            sb.WriteString(strings.Join(reqs, ", "))
-            sb.WriteString("];\n\n")
+        c.checkRedirects(cmds)
+        if flt.Enabled == 0 {
+            // Give disableRule an if to switch off.
+            cmds = []*Command{{Name: "if", Test: NewTest("true"), Block: cmds}}
         }
+        if len(c.used) > 0 {
+            script.Commands = append(script.Commands, requireCommand(c.used))
+        }
+        if c.addrVars {
+            script.Commands = append(script.Commands, addressVariablesPrelude())
+        }
+        script.Commands = append(script.Commands, cmds...)
+        return script
+    }
 
-        // ── IF block ───────────────────────────────────────────────────────
-        sb.WriteString("if ")
-        sb.WriteString(cond)
-        sb.WriteString(" {\n")
+    cond := c.conditions(flt.Rules)
 
-        // ── Actions ────────────────────────────────────────────────────────
-        if len(flt.Actions) == 0 {
-            sb.WriteString("    # TODO: no actions defined in original filter\n")
-        } else {
-            for _, a := range flt.Actions {
-                action := strings.ToLower(strings.TrimSpace(a.Action))
-                dest := a.Dest
-
-                switch action {
-                case "save":
-                    mailbox := mailboxFromDest(dest)
-                    sb.WriteString(fmt.Sprintf("    fileinto %s;\n", quoteString(mailbox)))
-                    sb.WriteString(fmt.Sprintf("    # original path: %s\n", quoteString(dest)))
-                case "deliver":
-                    sb.WriteString(fmt.Sprintf("    fileinto %s;\n", quoteString(dest)))
-                case "reject":
-                    sb.WriteString(fmt.Sprintf("    reject %s;\n", quoteString(dest)))
-                case "finish":
-                    sb.WriteString("    # finish (Exim): terminate filter processing (handled by stop)\n")
-                default:
-                    sb.WriteString(fmt.Sprintf(
-                        "    # TODO: unsupported action %q dest=%q\n",
-                        a.Action, a.Dest,
-                    ))
-                }
-            }
+    // ── IF block ───────────────────────────────────────────────────────
+    ifCmd := &Command{Name: "if", Test: cond}
+    if chain, grouped := ChainText(flt.Rules), RuleExpr(flt.Rules).String(); chain != grouped {
+        // Mixed and/or: show how the cPanel rule chain was grouped.
+        ifCmd.Comments = []string{
+            "cPanel:  " + chain,
+            "Grouped: " + grouped,
         }
+    }
+    ifCmd.Comments = append(ifCmd.Comments, c.notes...)
 
+    // ── Actions ────────────────────────────────────────────────────────
+    if len(flt.Actions) == 0 {
+        ifCmd.Block = append(ifCmd.Block,
+            CommentBlock("TODO: no actions defined in original filter"),
+        )
+    }
+    ifCmd.Block = append(ifCmd.Block, c.actions(flt.Actions)...)
 
-sb.WriteString("    stop;\n")
-sb.WriteString("}\n")
-
-content := sb.String()
+    ifCmd.Block = append(ifCmd.Block, NewCommand("stop"))
+    c.checkRedirects(ifCmd.Block)
 
-// If the filter was disabled in cPanel, keep it but comment it out
-// so it does not run on the target system.
-if flt.Enabled == 0 {
-    var commentedLines []string
-    commentedLines = append(commentedLines,
-        fmt.Sprintf("# NOTE: this filter was disabled in cPanel (enabled=%d)", flt.Enabled),
-    )
-    for _, line := range strings.Split(content, "\n") {
-        if strings.TrimSpace(line) == "" {
-            commentedLines = append(commentedLines, "")
-        } else {
-            commentedLines = append(commentedLines, "# "+line)
-        }
+    // ── Require + prelude ──────────────────────────────────────────────
+    if len(c.used) > 0 {
+        script.Commands = append(script.Commands, requireCommand(c.used))
     }
-    content = strings.Join(commentedLines, "\n")
+    if c.addrVars {
+        script.Commands = append(script.Commands, addressVariablesPrelude())
+    }
+    script.Commands = append(script.Commands, ifCmd)
+    return script
 }
 
-scripts = append(scripts, SieveScript{
-    Name:    flt.Filtername,
-    Content: content,
-})
+// fileinto files into a mailbox, creating it on the fly when the target
+// supports the mailbox extension (RFC 5490); otherwise the folder must
+// exist before the first message arrives.
+func (c *converter) fileinto(mailbox string, unseen bool) []*Command {
+    c.used["fileinto"] = true
+    var args []Arg
+    if c.opts.Profile.Has("mailbox") {
+        c.used["mailbox"] = true
+        args = append(args, Tag("create"))
+    } else {
+        c.degrade("mailbox", "fileinto %q without :create; the folder must exist on the target", mailbox)
+    }
+    return c.withCopy("fileinto", append(args, String(mailbox)), unseen)
+}
 
+// redirect forwards to an address (Exim "deliver <address>").
+func (c *converter) redirect(addr string, unseen bool) []*Command {
+    return c.withCopy("redirect", []Arg{String(addr)}, unseen)
+}
 
+// withCopy builds a delivery command. For Exim "unseen" deliveries the
+// implicit keep must survive: ":copy" (RFC 3894) when available, else an
+// explicit keep after the command.
+func (c *converter) withCopy(name string, args []Arg, unseen bool) []*Command {
+    if !unseen {
+        return []*Command{NewCommand(name, args...)}
     }
-
-    return scripts
+    if c.opts.Profile.Has("copy") {
+        c.used["copy"] = true
+        return []*Command{NewCommand(name, append([]Arg{Tag("copy")}, args...)...)}
+    }
+    target := ""
+    for _, a := range args {
+        if _, isTag := a.(Tag); !isTag {
+            target = ArgStrings(a)[0]
+            break
+        }
+    }
+    c.degrade("copy", "unseen %s %s written as %s + keep", name, target, name)
+    return []*Command{NewCommand(name, args...), NewCommand("keep")}
 }
 
-// buildConditions builds a combined condition for a list of rules.
-// Returns (expression, usesBodyTest).
-func buildConditions(rules []Rule) (string, bool) {
-    if len(rules) == 1 {
-        return buildSingleCondition(&rules[0])
+// actions converts the actions of a filter in order.
+func (c *converter) actions(actions []Action) []*Command {
+    var cmds []*Command
+    for _, a := range actions {
+        action := strings.ToLower(strings.TrimSpace(a.Action))
+        dest := a.Dest
+
+        switch action {
+        case "discard":
+            cmds = append(cmds, c.discard("discard action"))
+        case "save":
+            if isDiscardDest(dest) {
+                cmds = append(cmds, c.discard("save "+quoteString(dest)))
+                continue
+            }
+            mailbox := mailboxFromDest(dest, c.opts)
+            cmds = append(cmds, c.fileinto(mailbox, a.Unseen)...)
+            cmds = append(cmds, CommentBlock("original path: "+quoteString(dest)))
+        case "deliver":
+            if isAddress(dest) {
+                cmds = append(cmds, c.redirect(c.expand(dest), a.Unseen)...)
+            } else {
+                cmds = append(cmds, c.fileinto(c.expand(dest), a.Unseen)...)
+            }
+        case "pipe":
+            cmds = append(cmds, c.pipe(dest, a.Unseen)...)
+        case "reject":
+            cmds = append(cmds, c.reject("reject", dest))
+        case "fail":
+            // cPanel writes SMTP-time failures as ":fail: message".
+            if strings.HasPrefix(dest, ":fail:") {
+                cmds = append(cmds, c.reject("ereject", strings.TrimPrefix(dest, ":fail:")))
+            } else {
+                cmds = append(cmds, c.reject("reject", dest))
+            }
+        case "error":
+            cmds = append(cmds, c.reject("ereject", dest))
+        case "freeze":
+            folder := c.opts.QuarantineFolder
+            if folder == "" {
+                folder = DefaultQuarantineFolder
+            }
+            note := "freeze (Exim): held for the admin; filed into the quarantine folder instead"
+            if dest != "" {
+                note += ", reason: " + quoteString(dest)
+            }
+            cmds = append(cmds, CommentBlock(note))
+            cmds = append(cmds, c.fileinto(folder, false)...)
+        case "finish":
+            if a.Seen && !delivers(actions) {
+                cmds = append(cmds, c.discard("seen finish without a delivery"))
+                continue
+            }
+            cmds = append(cmds,
+                CommentBlock("finish (Exim): terminate filter processing (handled by stop)"),
+            )
+        default:
+            cmds = append(cmds, CommentBlock(fmt.Sprintf(
+                "TODO: unsupported action %q dest=%q", a.Action, a.Dest,
+            )))
+        }
     }
+    return cmds
+}
 
-    var conds []string
-    usesBody := false
-    hasAnd := false
-    hasOr := false
+// discard drops the message and records it in the report.
+func (c *converter) discard(why string) *Command {
+    c.report.add(c.filter, ReportDiscard, "", "matching messages are dropped (%s)", why)
+    cmd := NewCommand("discard")
+    cmd.Comments = []string{"Exim: " + why}
+    return cmd
+}
 
-    for i := range rules {
-        r := &rules[i]
+// isDiscardDest reports destinations that throw the message away.
+func isDiscardDest(dest string) bool {
+    switch strings.TrimSpace(dest) {
+    case "/dev/null", ":blackhole:":
+        return true
+    }
+    return false
+}
 
-        opt := strings.ToLower(strings.TrimSpace(r.Opt))
-        switch opt {
-        case "and":
-            hasAnd = true
-        case "or", "":
-            hasOr = true
+// delivers reports whether any action of a filter delivers the message
+// (including rejecting it), as opposed to only discarding or finishing.
+func delivers(actions []Action) bool {
+    for _, a := range actions {
+        switch strings.ToLower(strings.TrimSpace(a.Action)) {
+        case "finish", "discard":
+        case "save":
+            if !isDiscardDest(a.Dest) {
+                return true
+            }
+        default:
+            return true
         }
+    }
+    return false
+}
 
-        c, cUsesBody := buildSingleCondition(r)
-        conds = append(conds, c)
-        if cUsesBody {
-            usesBody = true
-        }
+// reject refuses the message with the original text. Exim "fail" bounces
+// after acceptance, which is "reject"; ":fail:" and errors refuse during
+// the SMTP/LMTP dialogue where possible, which is "ereject" (RFC 5429).
+// Multi-line messages are printed as text: blocks.
+func (c *converter) reject(name, msg string) *Command {
+    msg = strings.TrimSpace(msg)
+    if msg == "" {
+        msg = defaultRejectMessage
+    }
+    if name == "ereject" && !c.opts.Profile.Has("ereject") {
+        c.degrade("ereject", "ereject %q written as reject (bounce after delivery)", msg)
+        name = "reject"
+    }
+    if !c.opts.Profile.Has(name) {
+        c.report.add(c.filter, ReportBlocking, name, "%s %q is not possible on the target; message is delivered", name, msg)
+        return CommentBlock(fmt.Sprintf("TODO: %s %s (extension not available)", name, quoteString(msg)))
+    }
+    c.used[name] = true
+    return NewCommand(name, String(msg))
+}
+
+// pipe maps an Exim "pipe" to vnd.dovecot.pipe. The command must be in
+// Options.PipeCommands; unmapped commands, or a target without the
+// extension, are blocking report items and stay as comments.
+func (c *converter) pipe(command string, unseen bool) []*Command {
+    fields := strings.Fields(command)
+    if len(fields) == 0 {
+        return []*Command{CommentBlock("TODO: pipe without a command")}
     }
 
-    join := "anyof"
-    if hasAnd && !hasOr {
-        join = "allof"
+    mapped, ok := c.opts.PipeCommands[strings.Join(fields, " ")]
+    args := []string{}
+    if !ok {
+        mapped, ok = c.opts.PipeCommands[fields[0]]
+        args = fields[1:]
+    }
+    if !ok || strings.TrimSpace(mapped) == "" {
+        c.report.add(c.filter, ReportBlocking, "vnd.dovecot.pipe",
+            "pipe command %q has no [pipe] mapping to a sieve_pipe_bin_dir program", command)
+        return []*Command{CommentBlock(fmt.Sprintf("TODO: pipe %s (no [pipe] mapping)", quoteString(command)))}
+    }
+    if !c.opts.Profile.Has("vnd.dovecot.pipe") {
+        c.report.add(c.filter, ReportBlocking, "vnd.dovecot.pipe",
+            "pipe command %q cannot run: the target does not allow vnd.dovecot.pipe in user scripts", command)
+        return []*Command{CommentBlock(fmt.Sprintf("TODO: pipe %s (vnd.dovecot.pipe not available)", quoteString(command)))}
     }
 
-    if len(conds) == 1 {
-        return conds[0], usesBody
+    target := strings.Fields(mapped)
+    pipeArgs := []Arg{String(target[0])}
+    if all := append(target[1:], args...); len(all) > 0 {
+        pipeArgs = append(pipeArgs, StringList(all))
     }
+    c.used["vnd.dovecot.pipe"] = true
+    cmds := c.withCopy("pipe", pipeArgs, unseen)
+    cmds[0].Comments = []string{"Exim: pipe " + quoteString(command)}
+    return cmds
+}
 
-    // Pretty-print:
-    // anyof (
-    //     cond1,
-    //     cond2,
-    // )
-    var b strings.Builder
-    b.WriteString(join)
-    b.WriteString(" (\n")
-    for i, c := range conds {
-        b.WriteString("    ")
-        b.WriteString(c)
-        if i < len(conds)-1 {
-            b.WriteString(",")
+// checkRedirects reports filters that redirect more often than the
+// target's sieve_max_redirects allows for one message.
+func (c *converter) checkRedirects(block []*Command) {
+    max := c.opts.Profile.MaxRedirects
+    if max <= 0 {
+        return
+    }
+    n := 0
+    for _, cmd := range block {
+        if cmd.Name == "redirect" {
+            n++
         }
-        b.WriteString("\n")
     }
-    b.WriteString(")")
-
-    return b.String(), usesBody
+    if n > max {
+        c.report.add(c.filter, ReportBlocking, "",
+            "%d redirects exceed the target limit of %d (sieve_max_redirects); the script fails at delivery", n, max)
+    }
 }
 
-// buildSingleCondition converts a single rule to a Sieve boolean expression.
-// Returns (condition, usesBodyTest).
-func buildSingleCondition(r *Rule) (string, bool) {
-    part := strings.ToLower(strings.TrimSpace(r.Part))
-    match := strings.ToLower(strings.TrimSpace(r.Match))
-    val := r.Val
+// isAddress tells an Exim delivery address from a folder name.
+func isAddress(dest string) bool {
+    return strings.Contains(dest, "@") && !strings.ContainsAny(dest, "/ ")
+}
 
+// eximAddressVars maps the Exim address variables to their Sieve names.
+var eximAddressVars = []struct{ exim, sieve string }{
+    {"${local_part}", "${local_part}"},
+    {"$local_part", "${local_part}"},
+    {"${domain}", "${domain}"},
+    {"$domain", "${domain}"},
+}
 
-    // Regex-based matches are considered unsafe/unsupported — we drop them.
-    if match == "matches_regex" || match == "does not match" {
-        return fmt.Sprintf(
-            "false /* TODO: regex/does-not-match rule ignored (%s %q %s) */",
-            r.Part, r.Match, r.Val,
-        ), false
+// expand rewrites $local_part / $domain in a value into Sieve variables
+// set by addressVariablesPrelude. Without the variables extension the
+// value is kept literally and reported.
+func (c *converter) expand(val string) string {
+    if !strings.Contains(val, "$local_part") && !strings.Contains(val, "${local_part}") &&
+        !strings.Contains(val, "$domain") && !strings.Contains(val, "${domain}") {
+        return val
+    }
+    if !c.opts.Profile.Has("variables") || !c.opts.Profile.Has("envelope") {
+        c.degrade("variables", "%q refers to Exim address variables; kept literally", val)
+        return val
     }
 
-    // Special-case: cPanel "matches" often used as simple ^prefix regex,
-    // e.g. ^Suspended:  →  Subject starting with "Suspended:".
-    // We convert simple cases to Sieve :matches globs, otherwise fall back
-    // to a safe false condition.
-    if match == "matches" {
-        if glob, ok := simpleRegexToGlob(val); ok {
-            field := mapPart(part)
-            if field.kind == fieldBody {
-                cond := fmt.Sprintf(`body :matches %s`, quoteString(glob))
-                return cond, true
+    var b strings.Builder
+    for i := 0; i < len(val); {
+        replaced := false
+        for _, v := range eximAddressVars {
+            if strings.HasPrefix(val[i:], v.exim) {
+                b.WriteString(v.sieve)
+                i += len(v.exim)
+                replaced = true
+                break
             }
-            hdrExpr := field.headerExpr()
-            cond := fmt.Sprintf(`%s :matches %s %s`, field.test(), hdrExpr, quoteString(glob))
-            return cond, false
         }
-        return fmt.Sprintf(
-            "false /* TODO: unsupported match %q on %s %q */",
-            r.Match, r.Part, r.Val,
-        ), false
+        if !replaced {
+            b.WriteByte(val[i])
+            i++
+        }
     }
+    c.used["variables"] = true
+    c.used["envelope"] = true
+    c.addrVars = true
+    return b.String()
+}
 
+// addressVariablesPrelude sets ${local_part} and ${domain} from the
+// envelope recipient, the way Exim defines them for a user filter.
+func addressVariablesPrelude() *Command {
+    set := &Command{
+        Name: "if",
+        Test: NewTest("envelope", Tag("matches"), String("to"), String("*@*")),
+        Block: []*Command{
+            NewCommand("set", String("local_part"), String("${1}")),
+            NewCommand("set", String("domain"), String("${2}")),
+        },
+    }
+    set.Comments = []string{"Exim $local_part / $domain of the recipient"}
+    return set
+}
 
-    field := mapPart(part)
-    op, negative, bodyPattern := mapMatch(match, val)
-
-    if op == "" && bodyPattern == "" {
-        return fmt.Sprintf(
-            "true /* TODO: unsupported match %q on %s %q */",
-            r.Match, r.Part, r.Val,
-        ), false
+// requireCommand builds a single sorted require ["..."] command.
+func requireCommand(exts map[string]bool) *Command {
+    var reqs []string
+    for k := range exts {
+        reqs = append(reqs, k)
     }
+    sort.Strings(reqs)
+    return NewCommand("require", StringList(reqs))
+}
 
-    // Body: "body :contains \"...\"" etc.
-    if field.kind == fieldBody {
-        cond := fmt.Sprintf("body %s %s", op, quoteString(bodyPattern))
-        if negative {
-            cond = "not (" + cond + ")"
+// disableRule switches off the rule's if the way Roundcube does: the test
+// becomes false and the original test follows as a comment, so enabling
+// the filter in the UI restores it.
+func disableRule(script *Script) {
+    for _, cmd := range script.Commands {
+        if cmd.Name != "if" || setOnly(cmd) {
+            continue
         }
-        return cond, true
+        cmd.Comments = append(cmd.Comments, "NOTE: this filter was disabled in cPanel")
+        cmd.Test = &Test{Name: "false", LineComment: cmd.Test.OneLine()}
     }
+}
 
-    // Header/address fields
-    hdrExpr := field.headerExpr()
-    cond := fmt.Sprintf("%s %s %s %s", field.test(), op, hdrExpr, quoteString(bodyPattern))
+// setOnly reports whether an if only assigns variables (a prelude).
+func setOnly(cmd *Command) bool {
+    _, ok := setPreludeKey(cmd)
+    return ok
+}
 
-    if negative {
-        cond = "not (" + cond + ")"
+// commentOut turns a script into a comment-only script, keeping its text
+// readable line by line under a leading note.
+func commentOut(script *Script, note string) *Script {
+    lines := []string{note}
+    for _, line := range strings.Split(strings.TrimRight(script.String(), "\n"), "\n") {
+        lines = append(lines, line)
     }
-
-    return cond, false
+    return &Script{Commands: []*Command{CommentBlock(lines...)}}
 }
 
-// ─────────────────────────── Field mapping helpers ─────────────────────────
+// conditions builds the condition for a rule chain, nesting allof/anyof
+// so that "and" binds tighter than "or" as it does in Exim.
+func (c *converter) conditions(rules []Rule) *Test {
+    return c.exprTest(RuleExpr(rules))
+}
 
-type fieldKind int
+func (c *converter) exprTest(e *Expr) *Test {
+    switch e.Op {
+    case ExprRule:
+        return c.condition(e.Rule)
+    }
+    join := "anyof"
+    if e.Op == ExprAnd {
+        join = "allof"
+    }
+    t := &Test{Name: join}
+    for _, term := range e.Terms {
+        t.Tests = append(t.Tests, c.exprTest(term))
+    }
+    return t
+}
 
-const (
-    fieldHeader fieldKind = iota
-    fieldAddress
-    fieldBody
-)
+// placeholderTest is a constant true/false test carrying a TODO comment
+// for rules that could not be converted.
+func placeholderTest(value bool, comment string) *Test {
+    name := "false"
+    if value {
+        name = "true"
+    }
+    return &Test{Name: name, Comment: comment}
+}
 
-type fieldInfo struct {
-    kind    fieldKind
-    headers []string
+// negate wraps a test into "not".
+func negate(t *Test) *Test {
+    return &Test{Name: "not", Tests: []*Test{t}}
 }
 
-func (f fieldInfo) test() string {
-    switch f.kind {
-    case fieldAddress:
-        return "address"
-    case fieldHeader:
-        return "header"
-    default:
-        return "header"
-    }
-}
-
-func (f fieldInfo) headerExpr() string {
-    if len(f.headers) == 1 {
-        return quoteString(f.headers[0])
-    }
-    var parts []string
-    for _, h := range f.headers {
-        parts = append(parts, quoteString(h))
-    }
-    return "[" + strings.Join(parts, ", ") + "]"
-}
-
-// mapPart maps cPanel "part" to Sieve field info.
-// Handles things like "$header_subject:", "$header_from:", "$message_body".
-func mapPart(part string) fieldInfo {
-    p := strings.ToLower(strings.TrimSpace(part))
-
-    // Strip Exim/cPanel-style prefixes/suffixes
-    if strings.HasPrefix(p, "$header_") {
-        p = strings.TrimPrefix(p, "$header_")
-    }
-    p = strings.TrimPrefix(p, "$")
-    p = strings.TrimSuffix(p, ":")
-    p = strings.TrimSpace(p)
-
-    switch p {
-    case "from", "h_from":
-        return fieldInfo{kind: fieldAddress, headers: []string{"From"}}
-    case "to", "h_to":
-        return fieldInfo{kind: fieldAddress, headers: []string{"To"}}
-    case "subject", "h_subject":
-        return fieldInfo{kind: fieldHeader, headers: []string{"Subject"}}
-    case "any recipient", "any_recipient", "anyrecipient":
-        return fieldInfo{kind: fieldAddress, headers: []string{"To", "Cc", "Bcc"}}
-    case "reply", "reply-to", "reply_to":
-        return fieldInfo{kind: fieldHeader, headers: []string{"Reply-To"}}
-    case "body", "message_body":
-        return fieldInfo{kind: fieldBody}
-    case "any header", "any_header", "anyheader":
-        return fieldInfo{
-            kind:    fieldHeader,
-            headers: []string{"From", "To", "Cc", "Bcc", "Subject", "Reply-To"},
+// condition converts a single rule to a Sieve test.
+func (c *converter) condition(r *Rule) *Test {
+    match := strings.ToLower(strings.TrimSpace(r.Match))
+    val := r.Val
+    field, err := mapPart(r.Part, c.opts)
+    if err != nil {
+        c.report.add(c.filter, ReportBlocking, "", "%s: %v; the rule never matches", ruleText(r), err)
+        return placeholderTest(false, fmt.Sprintf("TODO: %s: %v", strings.TrimSpace(r.Part), err))
+    }
+    if exp := unsupportedExpansion(val); exp != "" {
+        c.report.add(c.filter, ReportBlocking, "", "%s: %s in the value cannot be evaluated in Sieve; the rule never matches", ruleText(r), exp)
+        return placeholderTest(false, fmt.Sprintf("TODO: value %q uses %s", r.Val, exp))
+    }
+    if field.note != "" {
+        c.report.add(c.filter, ReportApprox, "", "%s: %s", ruleText(r), field.note)
+    }
+    rel, negative, numeric := numericMatch(match)
+    field, val = c.rewriteSpam(r, field, val, numeric)
+
+    if field.kind == fieldBody && !c.opts.Profile.Has("body") {
+        c.degrade("body", "body rule %s %q cannot be tested; it never matches", r.Match, r.Val)
+        return placeholderTest(false, fmt.Sprintf(
+            "TODO: body test %s %q needs the body extension", r.Match, r.Val,
+        ))
+    }
+    if numeric {
+        return c.numeric(r, field, val, rel, negative)
+    }
+    if field.kind == fieldSize {
+        c.report.add(c.filter, ReportBlocking, "", "%s: $message_size only converts with is above / is below; the rule never matches", ruleText(r))
+        return placeholderTest(false, fmt.Sprintf("TODO: %s %q on $message_size", r.Match, r.Val))
+    }
+    if field.anyRecipient {
+        c.degrade("envelope", "%s is tested on the To/Cc/Bcc headers instead of the envelope", ruleText(r))
+    }
+    if field.kind == fieldEnvelope && !c.opts.Profile.Has("envelope") {
+        c.degrade("envelope", "%s cannot be tested without the envelope; it never matches", ruleText(r))
+        return placeholderTest(false, fmt.Sprintf(
+            "TODO: %s needs the envelope extension", strings.TrimSpace(r.Part),
+        ))
+    }
+
+    // subject builds "<test> [<address part>] <match> <field> <key>" for
+    // the rule's field.
+    subject := func(matchType, key string) *Test {
+        // Exim's capitalised verbs compare case-sensitively.
+        matchArgs := func(rest ...Arg) []Arg {
+            args := []Arg{Tag(matchType)}
+            if r.CaseSensitive {
+                args = append(args, Tag("comparator"), String("i;octet"))
+            }
+            return append(args, rest...)
         }
-    default:
-        // Unknown part – treat as generic header name
-        // Try to capitalize standard ones a bit
-        if p == "" {
-            p = "Subject"
+        address := func(kind, header string) *Test {
+            var args []Arg
+            if field.addressPart != "" {
+                args = append(args, Tag(field.addressPart))
+            }
+            return NewTest(kind, append(args, matchArgs(String(header), String(key))...)...)
+        }
+        switch field.kind {
+        case fieldBody:
+            c.used["body"] = true
+            return NewTest("body", matchArgs(String(key))...)
+        case fieldReplyAddress:
+            // Exim's $reply_address is Reply-To, or From without one.
+            return &Test{Name: "anyof", Tests: []*Test{
+                address("address", "Reply-To"),
+                {Name: "allof", Tests: []*Test{
+                    negate(NewTest("exists", String("Reply-To"))),
+                    address("address", "From"),
+                }},
+            }}
+        case fieldEnvelope:
+            c.used["envelope"] = true
+            return address("envelope", field.headers[0])
+        }
+        var args []Arg
+        if field.addressPart != "" {
+            args = append(args, Tag(field.addressPart))
         }
-        return fieldInfo{kind: fieldHeader, headers: []string{p}}
+        return NewTest(field.test(), append(args, matchArgs(field.headerArg(), String(key))...)...)
+    }
+
+    // Regex matches (cPanel "matches", "matches_regex", "does not match").
+    // Simple anchored patterns become :matches globs; everything else is
+    // translated to POSIX ERE for the :regex extension.
+    switch match {
+    case "matches", "matches_regex", "does not match":
+        var cond *Test
+        if glob, ok := simpleRegexToGlob(val); ok {
+            cond = subject("matches", glob)
+        } else if !c.opts.Profile.Has("regex") {
+            c.degrade("regex", "regex %q on %s cannot be tested; it never matches", r.Val, r.Part)
+            return placeholderTest(false, fmt.Sprintf(
+                "TODO: regex %q on %s needs the regex extension", r.Val, r.Part,
+            ))
+        } else {
+            ere, err := translateRegex(val)
+            if err != nil {
+                c.report.add(c.filter, ReportBlocking, "",
+                    "regex %q on %s is untranslatable (%v); the rule never matches", r.Val, r.Part, err)
+                return placeholderTest(false, fmt.Sprintf(
+                    "TODO: untranslatable regex %q on %s: %v",
+                    r.Val, r.Part, err,
+                ))
+            }
+            c.used["regex"] = true
+            cond = subject("regex", ere)
+        }
+        if match == "does not match" {
+            cond = negate(cond)
+        }
+        return cond
     }
-}
 
+    op, negative, pattern := mapMatch(match, val)
 
+    if op == "" {
+        c.report.add(c.filter, ReportBlocking, "", "%s: unsupported match type; the rule never matches", ruleText(r))
+        return placeholderTest(false, fmt.Sprintf(
+            "TODO: unsupported match %q on %s %q",
+            r.Match, r.Part, r.Val,
+        ))
+    }
 
+    cond := subject(op, c.expand(pattern))
+    if negative {
+        cond = negate(cond)
+    }
+
+    return cond
+}
 
 // simpleRegexToGlob tries to convert very simple regex-like patterns
 // into Sieve :matches globs. Examples:
@@ -396,63 +771,47 @@ func simpleRegexToGlob(pattern string) (string, bool) {
 
 
 
-// mapMatch maps cPanel match -> (sieveOp, negative, pattern).
-func mapMatch(match, val string) (sieveOp string, negative bool, bodyPattern string) {
-    if val == "" {
-        return "", false, ""
-    }
-
-    bodyPattern = val
-
+// mapMatch maps cPanel match -> (sieve match type, negative, pattern).
+// An empty value is kept: is "" tests for an empty header.
+func mapMatch(match, val string) (sieveOp string, negative bool, pattern string) {
     switch match {
     case "contains":
-        return ":contains", false, val
+        return "contains", false, val
     case "does not contain", "does not contains":
-        return ":contains", true, val
+        return "contains", true, val
 
     case "equals", "is":
-        return ":is", false, val
+        return "is", false, val
     case "does not equal", "is not":
-        return ":is", true, val
+        return "is", true, val
 
     case "begins", "begins with":
-        return ":matches", false, val + "*"
+        return "matches", false, globEscape(val) + "*"
     case "does not begin", "does not begin with":
-        return ":matches", true, val + "*"
+        return "matches", true, globEscape(val) + "*"
 
     case "ends", "ends with":
-        return ":matches", false, "*" + val
+        return "matches", false, "*" + globEscape(val)
     case "does not end", "does not end with":
-        return ":matches", true, "*" + val
+        return "matches", true, "*" + globEscape(val)
 
     default:
         return "", false, ""
     }
 }
 
-// mailboxFromDest extracts a mailbox name from a cPanel save path.
-// e.g. "$home/mail/myip.gr/chris/.Nixpal" -> "Nixpal".
-func mailboxFromDest(path string) string {
-    if path == "" {
-        return "INBOX"
-    }
-
-    base := path
-    if idx := strings.LastIndex(base, "/"); idx != -1 {
-        base = base[idx+1:]
+// globEscape quotes the :matches wildcards in a literal value, so that
+// begins "[*URGENT*]" stays a prefix test.
+func globEscape(val string) string {
+    if !strings.ContainsAny(val, `*?\`) {
+        return val
     }
-    base = strings.TrimSpace(base)
-    base = strings.TrimPrefix(base, ".")
-
-    if base == "" {
-        return path
+    var b strings.Builder
+    for i := 0; i < len(val); i++ {
+        if val[i] == '*' || val[i] == '?' || val[i] == '\\' {
+            b.WriteByte('\\')
+        }
+        b.WriteByte(val[i])
     }
-    return base
-}
-
-// quoteString escapes a Go string into a Sieve double-quoted string
-func quoteString(s string) string {
-    s = strings.ReplaceAll(s, `\`, `\\`)
-    s = strings.ReplaceAll(s, `"`, `\"`)
-    return `"` + s + `"`
+    return b.String()
 }
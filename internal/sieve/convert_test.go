@@ -0,0 +1,175 @@
+package sieve
+
+import (
+    "strings"
+    "testing"
+)
+
+// TestDisabledFilterDoesNotRun converts disabled filters, with and without
+// rules, and checks that the generated script leaves the message alone.
+func TestDisabledFilterDoesNotRun(t *testing.T) {
+    actions := []Action{
+        {Action: "save", Dest: "$home/mail/ex.gr/chris/.Junk"},
+        {Action: "deliver", Dest: "boss@ex.gr"},
+    }
+    filters := map[string]FilterEntry{
+        "with rules": {
+            Filtername: "Junk",
+            Rules:      []Rule{{Part: "$header_subject:", Match: "contains", Val: "invoice"}},
+            Actions:    actions,
+        },
+        "rule-less": {Filtername: "Junk", Actions: actions},
+    }
+    modes := map[string]func(*Options){
+        "comment":            func(o *Options) {},
+        "disabled roundcube": func(o *Options) { o.DisabledFilters = DisabledRoundcube },
+        "dialect roundcube":  func(o *Options) { o.Dialect = DialectRoundcube },
+    }
+    for fname, flt := range filters {
+        for mname, set := range modes {
+            t.Run(fname+"/"+mname, func(t *testing.T) {
+                opts := DefaultOptions()
+                set(&opts)
+
+                // Enabled, the filter must fire on the test message.
+                flt.Enabled = 1
+                if res := simulateFilter(t, flt, opts); len(res.Actions) == 0 {
+                    t.Fatalf("enabled filter did not run (notes %v)", res.Notes)
+                }
+
+                flt.Enabled = 0
+                res := simulateFilter(t, flt, opts)
+                if len(res.Actions) != 0 || !res.ImplicitKeep {
+                    t.Errorf("disabled filter ran: actions %v, implicit keep %v", res.Actions, res.ImplicitKeep)
+                }
+            })
+        }
+    }
+}
+
+func simulateFilter(t *testing.T, flt FilterEntry, opts Options) SimResult {
+    t.Helper()
+    msg := testMessage()
+    msg.Header["Subject"] = []string{"Invoice 17"}
+    return simulateFilterMessage(t, flt, opts, msg)
+}
+
+func simulateFilterMessage(t *testing.T, flt FilterEntry, opts Options, msg *Message) SimResult {
+    t.Helper()
+    scripts, report := ConvertFilters(Filter{Filter: []FilterEntry{flt}}, opts)
+    combined := ApplyDialect(CombineScripts("t", scripts), opts, report)
+    s, err := ParseScript(combined.Content)
+    if err != nil {
+        t.Fatalf("parse: %v\n%s", err, combined.Content)
+    }
+    return Simulate(s, msg)
+}
+
+// TestCaseSensitiveRule checks that Exim's capitalised verbs compare with
+// i;octet, and that SOGo leaves them to sogo-extra.
+func TestCaseSensitiveRule(t *testing.T) {
+    rules := map[string]Rule{
+        "contains": {Part: "$header_subject:", Match: "contains", Val: "Invoice"},
+        "is":       {Part: "$header_from:", Match: "is", Val: "boss@ex.gr"},
+        "begins":   {Part: "$header_subject:", Match: "begins", Val: "invoice"},
+    }
+    for name, r := range rules {
+        t.Run(name, func(t *testing.T) {
+            flt := FilterEntry{
+                Filtername: "Case",
+                Enabled:    1,
+                Rules:      []Rule{r},
+                Actions:    []Action{{Action: "save", Dest: "$home/mail/ex.gr/chris/.Case"}},
+            }
+            opts := DefaultOptions()
+            msg := testMessage()
+            msg.Header["From"] = []string{"BOSS@ex.gr"}
+            msg.Header["Subject"] = []string{"INVOICE 17"}
+
+            if res := simulateFilterMessage(t, flt, opts, msg); len(res.Actions) == 0 {
+                t.Errorf("case-insensitive %s did not match", r.Match)
+            }
+            flt.Rules[0].CaseSensitive = true
+            if res := simulateFilterMessage(t, flt, opts, msg); len(res.Actions) != 0 {
+                t.Errorf("case-sensitive %s matched: %v", r.Match, res.Actions)
+            }
+
+            filters, rest, _ := ConvertSOGo(Filter{Filter: []FilterEntry{flt}}, opts)
+            if len(filters) != 0 || len(rest.Filter) != 1 {
+                t.Errorf("SOGo filters = %v, rest = %v; want the filter in rest", filters, rest.Filter)
+            }
+        })
+    }
+}
+
+// TestNoMatchAllPlaceholder checks that rules which cannot be converted as
+// written never turn into tests that match every message.
+func TestNoMatchAllPlaceholder(t *testing.T) {
+    save := []Action{{Action: "save", Dest: "$home/mail/ex.gr/chris/.Junk"}}
+    empty := FilterEntry{
+        Filtername: "Empty",
+        Enabled:    1,
+        Rules:      []Rule{{Part: "$header_subject:", Match: "is", Val: ""}},
+        Actions:    save,
+    }
+    scripts, report := ConvertFilters(Filter{Filter: []FilterEntry{empty}}, DefaultOptions())
+    if !strings.Contains(scripts[0].Content, `header :is "Subject" ""`) || len(report.Items) != 0 {
+        t.Errorf("empty value:\n%s%v", scripts[0].Content, report.Items)
+    }
+    if res := simulateFilter(t, empty, DefaultOptions()); len(res.Actions) != 0 {
+        t.Errorf("is \"\" matched a subject: %v", res.Actions)
+    }
+    msg := testMessage()
+    msg.Header["Subject"] = []string{""}
+    if res := simulateFilterMessage(t, empty, DefaultOptions(), msg); len(res.Actions) == 0 {
+        t.Errorf("is \"\" did not match an empty subject")
+    }
+
+    unknown := FilterEntry{
+        Filtername: "Unknown",
+        Enabled:    1,
+        Rules:      []Rule{{Part: "$header_subject:", Match: "sounds like", Val: "invoice"}},
+        Actions:    save,
+    }
+    scripts, report = ConvertFilters(Filter{Filter: []FilterEntry{unknown}}, DefaultOptions())
+    if !strings.Contains(scripts[0].Content, "if false") {
+        t.Errorf("unknown match type:\n%s", scripts[0].Content)
+    }
+    if len(report.Items) != 1 || report.Items[0].Kind != ReportBlocking {
+        t.Errorf("report = %v, want one blocking item", report.Items)
+    }
+}
+
+// TestBeginsEndsLiteral checks that wildcards in begins/ends values are
+// compared literally.
+func TestBeginsEndsLiteral(t *testing.T) {
+    cases := []struct {
+        match, val, subject string
+        want                bool
+    }{
+        {"begins", "[*URGENT*]", "[*URGENT*] call me", true},
+        {"begins", "[*URGENT*]", "[ex URGENT now] call me", false},
+        {"ends", "done?", "are we done?", true},
+        {"ends", "done?", "are we done!", false},
+        {"begins", `C:\tmp`, `C:\tmp\x`, true},
+        {"does not begin", "a*", "abc", true},
+    }
+    for _, tc := range cases {
+        flt := FilterEntry{
+            Filtername: "Literal",
+            Enabled:    1,
+            Rules:      []Rule{{Part: "$header_subject:", Match: tc.match, Val: tc.val}},
+            Actions:    []Action{{Action: "save", Dest: "$home/mail/ex.gr/chris/.Hit"}},
+        }
+        msg := testMessage()
+        msg.Header["Subject"] = []string{tc.subject}
+        if got := len(simulateFilterMessage(t, flt, DefaultOptions(), msg).Actions) != 0; got != tc.want {
+            t.Errorf("%s %q on %q = %v, want %v", tc.match, tc.val, tc.subject, got, tc.want)
+        }
+    }
+
+    op, _, pattern := mapMatch("begins", "[*URGENT*]")
+    if op != "matches" || pattern != `[\*URGENT\*]*` {
+        t.Errorf("mapMatch = %s %q", op, pattern)
+    }
+}
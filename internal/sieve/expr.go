@@ -0,0 +1,95 @@
+package sieve
+
+import (
+    "fmt"
+    "strings"
+)
+
+// Expression operators.
+const (
+    ExprRule = "rule"
+    ExprAnd  = "and"
+    ExprOr   = "or"
+)
+
+// Expr is the boolean structure of a filter's conditions: a rule leaf or
+// an and/or over sub-expressions, in evaluation order.
+type Expr struct {
+    Op    string
+    Rule  *Rule
+    Terms []*Expr
+}
+
+// RuleExpr builds the expression tree for a cPanel rule chain. Rule.Opt is
+// the connector between a rule and the one before it (the first rule's Opt
+// is ignored). As in Exim, "and" binds tighter than "or":
+//
+//   A and B or C   ->   (A and B) or C
+func RuleExpr(rules []Rule) *Expr {
+    if len(rules) == 0 {
+        return nil
+    }
+
+    var groups [][]*Expr
+    for i := range rules {
+        leaf := &Expr{Op: ExprRule, Rule: &rules[i]}
+        opt := strings.ToLower(strings.TrimSpace(rules[i].Opt))
+        if i > 0 && opt == "and" {
+            groups[len(groups)-1] = append(groups[len(groups)-1], leaf)
+            continue
+        }
+        groups = append(groups, []*Expr{leaf})
+    }
+
+    var terms []*Expr
+    for _, g := range groups {
+        if len(g) == 1 {
+            terms = append(terms, g[0])
+            continue
+        }
+        terms = append(terms, &Expr{Op: ExprAnd, Terms: g})
+    }
+    if len(terms) == 1 {
+        return terms[0]
+    }
+    return &Expr{Op: ExprOr, Terms: terms}
+}
+
+// String renders the expression with explicit parentheses, e.g.
+// (from contains "X" and subject contains "Y") or to is "Z".
+func (e *Expr) String() string {
+    switch e.Op {
+    case ExprRule:
+        return ruleText(e.Rule)
+    }
+    parts := make([]string, 0, len(e.Terms))
+    for _, t := range e.Terms {
+        s := t.String()
+        if t.Op != ExprRule {
+            s = "(" + s + ")"
+        }
+        parts = append(parts, s)
+    }
+    return strings.Join(parts, " "+e.Op+" ")
+}
+
+// ChainText renders a rule chain the way cPanel shows it: left to right,
+// without grouping.
+func ChainText(rules []Rule) string {
+    var b strings.Builder
+    for i := range rules {
+        if i > 0 {
+            opt := strings.ToLower(strings.TrimSpace(rules[i].Opt))
+            if opt != "and" {
+                opt = "or"
+            }
+            b.WriteString(" " + opt + " ")
+        }
+        b.WriteString(ruleText(&rules[i]))
+    }
+    return b.String()
+}
+
+func ruleText(r *Rule) string {
+    return fmt.Sprintf("%s %s %s", strings.TrimSpace(r.Part), strings.TrimSpace(r.Match), quoteString(r.Val))
+}
@@ -0,0 +1,74 @@
+package sieve
+
+import (
+    "testing"
+)
+
+func TestRuleExpr(t *testing.T) {
+    rule := func(opt, header, val string) Rule {
+        return Rule{Part: "$header_" + header + ":", Match: "contains", Val: val, Opt: opt}
+    }
+    tests := []struct {
+        name  string
+        rules []Rule
+        expr  string // Expr.String()
+        test  string // the Sieve test, on one line
+    }{
+        {
+            name:  "single rule",
+            rules: []Rule{rule("or", "from", "A")},
+            expr:  `$header_from: contains "A"`,
+            test:  `address :contains "From" "A"`,
+        },
+        {
+            name:  "single rule with and",
+            rules: []Rule{rule("and", "subject", "A")},
+            expr:  `$header_subject: contains "A"`,
+            test:  `header :contains "Subject" "A"`,
+        },
+        {
+            name:  "A and B or C",
+            rules: []Rule{rule("or", "from", "A"), rule("and", "subject", "B"), rule("or", "to", "C")},
+            expr:  `($header_from: contains "A" and $header_subject: contains "B") or $header_to: contains "C"`,
+            test:  `anyof (allof (address :contains "From" "A", header :contains "Subject" "B"), address :contains "To" "C")`,
+        },
+        {
+            name:  "A or B and C",
+            rules: []Rule{rule("or", "from", "A"), rule("or", "subject", "B"), rule("and", "to", "C")},
+            expr:  `$header_from: contains "A" or ($header_subject: contains "B" and $header_to: contains "C")`,
+            test:  `anyof (address :contains "From" "A", allof (header :contains "Subject" "B", address :contains "To" "C"))`,
+        },
+        {
+            name:  "chain starting with and",
+            rules: []Rule{rule("and", "from", "A"), rule("or", "subject", "B"), rule("and", "to", "C")},
+            expr:  `$header_from: contains "A" or ($header_subject: contains "B" and $header_to: contains "C")`,
+            test:  `anyof (address :contains "From" "A", allof (header :contains "Subject" "B", address :contains "To" "C"))`,
+        },
+        {
+            name:  "only and",
+            rules: []Rule{rule("", "from", "A"), rule("and", "subject", "B"), rule("AND ", "to", "C")},
+            expr:  `$header_from: contains "A" and $header_subject: contains "B" and $header_to: contains "C"`,
+            test:  `allof (address :contains "From" "A", header :contains "Subject" "B", address :contains "To" "C")`,
+        },
+        {
+            name:  "only or",
+            rules: []Rule{rule("or", "from", "A"), rule("or", "subject", "B")},
+            expr:  `$header_from: contains "A" or $header_subject: contains "B"`,
+            test:  `anyof (address :contains "From" "A", header :contains "Subject" "B")`,
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := RuleExpr(tt.rules).String(); got != tt.expr {
+                t.Errorf("String() = %s\nwant       %s", got, tt.expr)
+            }
+            c := &converter{opts: DefaultOptions(), report: &Report{}, used: map[string]bool{}}
+            if got := c.conditions(tt.rules).OneLine(); got != tt.test {
+                t.Errorf("test = %s\nwant   %s", got, tt.test)
+            }
+        })
+    }
+    if RuleExpr(nil) != nil {
+        t.Errorf("RuleExpr(nil) != nil")
+    }
+}
@@ -0,0 +1,312 @@
+package sieve
+
+import (
+    "fmt"
+    "strings"
+)
+
+// ─────────────────────────── Field mapping helpers ─────────────────────────
+
+type fieldKind int
+
+const (
+    fieldHeader fieldKind = iota
+    fieldAddress
+    fieldBody
+    fieldEnvelope     // envelope "from" / "to" (headers holds the part)
+    fieldReplyAddress // Exim $reply_address: Reply-To, else From
+    fieldSize         // $message_size, only with is above / is below
+)
+
+type fieldInfo struct {
+    kind    fieldKind
+    headers []string
+
+    // addressPart is the address part tag of address/envelope tests
+    // (localpart, domain, all); empty means the default (:all).
+    addressPart string
+
+    // note explains where the mapping is not exact, for the report.
+    note string
+
+    // anyRecipient marks cPanel's "any recipient" tested on the headers
+    // although Options.AnyRecipient asks for the envelope.
+    anyRecipient bool
+}
+
+func (f fieldInfo) test() string {
+    switch f.kind {
+    case fieldAddress, fieldReplyAddress:
+        return "address"
+    case fieldEnvelope:
+        return "envelope"
+    case fieldHeader:
+        return "header"
+    default:
+        return "header"
+    }
+}
+
+func (f fieldInfo) headerArg() Arg {
+    if len(f.headers) == 1 {
+        return String(f.headers[0])
+    }
+    return StringList(f.headers)
+}
+
+// addressHeaders are tested with "address" rather than "header", so that
+// display names and comments do not take part in the match.
+var addressHeaders = map[string]string{
+    "from": "From", "to": "To", "cc": "Cc", "bcc": "Bcc", "sender": "Sender",
+}
+
+// knownHeaders get their usual spelling in the script.
+var knownHeaders = map[string]string{
+    "subject": "Subject", "reply-to": "Reply-To", "message-id": "Message-ID",
+    "list-id": "List-Id", "x-spam-status": "X-Spam-Status", "x-spam-flag": "X-Spam-Flag",
+    "x-spam-score": "X-Spam-Score", "x-original-to": "X-Original-To",
+    "delivered-to": "Delivered-To", "return-path": "Return-Path",
+}
+
+// eximHeaderPrefixes are the header variables of Exim: $h_ / $header_
+// decode RFC 2047 like Sieve does; $rh_ (raw) and $bh_ (basic decoding)
+// have no exact equivalent.
+var eximHeaderPrefixes = []struct {
+    prefix string
+    note   string
+}{
+    {"$bheader_", "$bheader_ (basic decoding) is tested on the decoded header"},
+    {"$bh_", "$bh_ (basic decoding) is tested on the decoded header"},
+    {"$rheader_", "$rheader_ (raw header) is tested on the decoded header"},
+    {"$rh_", "$rh_ (raw header) is tested on the decoded header"},
+    {"$header_", ""},
+    {"$h_", ""},
+}
+
+// addressOperators are the Exim expansion operators that pick a part of an
+// address, mapped to the address part tag of Sieve.
+var addressOperators = map[string]string{
+    "local_part": "localpart",
+    "domain":     "domain",
+    "address":    "all",
+}
+
+// mapPart maps the left-hand side of a cPanel/Exim condition to Sieve
+// field info. It handles cPanel's names ("any recipient", "$header_subject:",
+// "$message_body") as well as Exim expansions:
+//
+//   $h_X-Original-To: / $header_X: / $rh_X: / $bh_X:   header X
+//   ${lc:...} / ${uc:...}             (Sieve compares case-insensitively)
+//   ${local_part:...} / ${domain:...} / ${address:...}   address parts
+//   $reply_address                    Reply-To, or From without one
+//   $sender_address                   envelope from
+//   $sender_address_local_part / _domain   envelope from (local part / domain)
+//   $local_part / $domain             envelope to (local part / domain)
+//   $original_local_part / _domain    envelope to, see originalNote
+//   $message_id                       Message-ID
+//   $message_size                     size (see numeric)
+//
+// "any recipient" is To/Cc/Bcc, or the envelope recipient when
+// opts.AnyRecipient is RecipientEnvelope and the profile has "envelope".
+// Anything else is returned as an error naming the expansion.
+func mapPart(part string, opts Options) (fieldInfo, error) {
+    s := strings.TrimSpace(part)
+    addressPart := ""
+
+    // Peel ${operator:...} wrappers.
+    for strings.HasPrefix(s, "${") && strings.HasSuffix(s, "}") {
+        inner := s[2 : len(s)-1]
+        op := inner
+        if i := strings.IndexAny(inner, ":{} "); i >= 0 {
+            op = inner[:i]
+        }
+        rest := strings.TrimPrefix(inner, op)
+        switch {
+        case rest == "" || isHeaderVar("$"+inner):
+            // Braced variable: ${sender_address}, ${h_subject:}
+            s = "$" + inner
+            continue
+        case !strings.HasPrefix(rest, ":"):
+            return fieldInfo{}, fmt.Errorf("expansion item ${%s...} is not supported", op)
+        }
+        switch op {
+        case "lc", "uc":
+            // Sieve's default comparator ignores case already.
+        case "local_part", "domain", "address":
+            if addressPart != "" {
+                return fieldInfo{}, fmt.Errorf("nested address operators in %s are not supported", part)
+            }
+            addressPart = addressOperators[op]
+        default:
+            return fieldInfo{}, fmt.Errorf("expansion operator ${%s:...} is not supported", op)
+        }
+        s = strings.TrimSpace(rest[1:])
+    }
+
+    f, err := mapVariable(s)
+    if err == nil && f.kind == fieldAddress && strings.Join(f.headers, ",") == "To,Cc,Bcc" &&
+        opts.AnyRecipient == RecipientEnvelope {
+        if opts.Profile.Has("envelope") {
+            f = fieldInfo{kind: fieldEnvelope, headers: []string{"to"}}
+        } else {
+            f.anyRecipient = true
+        }
+    }
+    if err != nil || addressPart == "" {
+        return f, err
+    }
+    switch f.kind {
+    case fieldHeader:
+        f.kind = fieldAddress
+    case fieldBody, fieldSize:
+        return fieldInfo{}, fmt.Errorf("${%s:...} of %s is not supported", addressPart, s)
+    }
+    if f.addressPart != "" && f.addressPart != addressPart {
+        return fieldInfo{}, fmt.Errorf("%s is not an address", part)
+    }
+    f.addressPart = addressPart
+    return f, nil
+}
+
+// originalNote: Exim keeps the address before aliasing in $original_*,
+// Sieve only sees the recipient the mail was delivered to.
+const originalNote = "$original_* is tested on the envelope recipient at delivery, which is the final address after aliases and forwarders"
+
+func isHeaderVar(s string) bool {
+    lower := strings.ToLower(s)
+    for _, h := range eximHeaderPrefixes {
+        if strings.HasPrefix(lower, h.prefix) {
+            return true
+        }
+    }
+    return false
+}
+
+// mapVariable maps a single Exim variable or cPanel part name.
+func mapVariable(s string) (fieldInfo, error) {
+    lower := strings.ToLower(s)
+
+    for _, h := range eximHeaderPrefixes {
+        if strings.HasPrefix(lower, h.prefix) {
+            name := strings.TrimSuffix(strings.TrimSpace(s[len(h.prefix):]), ":")
+            f := headerField(name)
+            f.note = h.note
+            return f, nil
+        }
+    }
+
+    if strings.HasPrefix(lower, "$") {
+        switch strings.TrimSuffix(strings.TrimPrefix(lower, "$"), ":") {
+        case "message_body", "body":
+            return fieldInfo{kind: fieldBody}, nil
+        case "message_headers", "message_headers_raw":
+            return anyHeaderField("$message_headers is tested on the common headers only"), nil
+        case "reply_address":
+            return fieldInfo{kind: fieldReplyAddress, headers: []string{"Reply-To"}}, nil
+        case "sender_address":
+            return fieldInfo{kind: fieldEnvelope, headers: []string{"from"}}, nil
+        case "sender_address_local_part":
+            return fieldInfo{kind: fieldEnvelope, headers: []string{"from"}, addressPart: "localpart"}, nil
+        case "sender_address_domain":
+            return fieldInfo{kind: fieldEnvelope, headers: []string{"from"}, addressPart: "domain"}, nil
+        case "local_part":
+            return fieldInfo{kind: fieldEnvelope, headers: []string{"to"}, addressPart: "localpart"}, nil
+        case "domain":
+            return fieldInfo{kind: fieldEnvelope, headers: []string{"to"}, addressPart: "domain"}, nil
+        case "original_local_part":
+            return fieldInfo{kind: fieldEnvelope, headers: []string{"to"}, addressPart: "localpart", note: originalNote}, nil
+        case "original_domain":
+            return fieldInfo{kind: fieldEnvelope, headers: []string{"to"}, addressPart: "domain", note: originalNote}, nil
+        case "message_id":
+            return fieldInfo{kind: fieldHeader, headers: []string{"Message-ID"}}, nil
+        case "message_size":
+            return fieldInfo{kind: fieldSize}, nil
+        case "from", "to", "subject", "reply", "h_from", "h_to", "h_subject":
+            // cPanel short forms, handled below
+        default:
+            return fieldInfo{}, fmt.Errorf("variable %s has no Sieve equivalent", s)
+        }
+    }
+
+    // cPanel part names
+    p := strings.TrimSuffix(strings.TrimSpace(strings.TrimPrefix(lower, "$")), ":")
+    p = strings.TrimPrefix(p, "h_")
+    switch p {
+    case "any recipient", "any_recipient", "anyrecipient":
+        return fieldInfo{kind: fieldAddress, headers: []string{"To", "Cc", "Bcc"}}, nil
+    case "reply", "reply_to":
+        return fieldInfo{kind: fieldHeader, headers: []string{"Reply-To"}}, nil
+    case "any header", "any_header", "anyheader":
+        return anyHeaderField(""), nil
+    case "body", "message_body":
+        return fieldInfo{kind: fieldBody}, nil
+    case "":
+        // Unknown part – cPanel's default field
+        return fieldInfo{kind: fieldHeader, headers: []string{"Subject"}}, nil
+    }
+    return headerField(strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(s), "$"), ":")), nil
+}
+
+// headerField tests a header by name; address headers use "address" and
+// known ones get their usual spelling. Other names keep their case.
+func headerField(name string) fieldInfo {
+    lower := strings.ToLower(name)
+    if h, ok := addressHeaders[lower]; ok {
+        return fieldInfo{kind: fieldAddress, headers: []string{h}}
+    }
+    if h, ok := knownHeaders[lower]; ok {
+        name = h
+    }
+    return fieldInfo{kind: fieldHeader, headers: []string{name}}
+}
+
+func anyHeaderField(note string) fieldInfo {
+    return fieldInfo{
+        kind:    fieldHeader,
+        headers: []string{"From", "To", "Cc", "Bcc", "Subject", "Reply-To"},
+        note:    note,
+    }
+}
+
+// eximValueVars are the Exim variables a value may refer to that Sieve
+// cannot evaluate; $local_part and $domain are handled by expand.
+var eximValueVars = []string{
+    "$h_", "$header_", "$rh_", "$rheader_", "$bh_", "$bheader_",
+    "$sender_address", "$reply_address", "$message_", "$original_",
+    "$thisaddress", "$home", "$n0", "$n1", "$n2", "$n3", "$n4", "$n5",
+    "$n6", "$n7", "$n8", "$n9", "$sn",
+}
+
+// unsupportedExpansion returns the first expansion in a value that cannot
+// be written in Sieve, or "".
+func unsupportedExpansion(val string) string {
+    lower := strings.ToLower(val)
+    for i := 0; i < len(lower); i++ {
+        if lower[i] != '$' || (i > 0 && lower[i-1] == '\\') {
+            continue
+        }
+        rest := lower[i:]
+        if strings.HasPrefix(rest, "${local_part}") || strings.HasPrefix(rest, "${domain}") {
+            continue
+        }
+        if strings.HasPrefix(rest, "${") {
+            end := strings.IndexAny(rest[2:], ":{}")
+            if end < 0 {
+                return val[i:]
+            }
+            return val[i : i+2+end]
+        }
+        for _, v := range eximValueVars {
+            if strings.HasPrefix(rest, v) {
+                end := strings.IndexAny(rest, " :\"'")
+                if end < 0 {
+                    end = len(rest)
+                } else if rest[end] == ':' {
+                    end++
+                }
+                return val[i : i+end]
+            }
+        }
+    }
+    return ""
+}
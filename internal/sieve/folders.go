@@ -0,0 +1,118 @@
+package sieve
+
+import (
+    "strings"
+)
+
+// DefaultFolderSeparator is the hierarchy separator of the target's mail
+// namespace (Dovecot with "separator = /", as on Mailcow).
+const DefaultFolderSeparator = "/"
+
+// mailboxFromDest extracts a mailbox name from a cPanel save path.
+// e.g. "$home/mail/myip.gr/chris/.Nixpal" -> "Nixpal". Maildir++ folders
+// (".Clients.Acme", or nested as ".Clients/.Acme") and bare folder names
+// ("INBOX.Sent", "Clients.Acme" from a "+Clients.Acme" subaddress) are
+// translated with MaildirFolder.
+func mailboxFromDest(path string, opts Options) string {
+    if path == "" {
+        return "INBOX"
+    }
+
+    path = strings.TrimSpace(path)
+    if !strings.Contains(path, "/") {
+        // A folder name rather than a path, as IMAP shows it.
+        if len(path) > len("INBOX.") && strings.EqualFold(path[:len("INBOX.")], "INBOX.") {
+            path = path[len("INBOX."):]
+        }
+        return MaildirFolder(path, opts)
+    }
+
+    parts := strings.Split(strings.TrimRight(path, "/"), "/")
+    i := len(parts)
+    for i > 0 && strings.HasPrefix(parts[i-1], ".") && strings.Trim(parts[i-1], ".") != "" {
+        i--
+    }
+    if i < len(parts) {
+        var levels []string
+        for _, p := range parts[i:] {
+            levels = append(levels, strings.TrimPrefix(p, "."))
+        }
+        return MaildirFolder(strings.Join(levels, "."), opts)
+    }
+
+    // A path, but not to a Maildir++ folder: use the last element as is.
+    base := strings.TrimSpace(parts[len(parts)-1])
+    if base == "" {
+        return path
+    }
+    if name, err := DecodeModifiedUTF7(base); err == nil {
+        return name
+    }
+    return base
+}
+
+// MaildirFolder translates a Maildir++ folder name as cPanel stores it on
+// disk (".Clients.Acme", the leading dot optional) into a mailbox name on
+// the target:
+//
+//   .Clients.Acme       ->   Clients/Acme
+//   .&A5MDsQPBA7cDwQ-   ->   Γαρηρ
+//   .Sent               ->   Sent Items   (FolderMap "INBOX.Sent" = "Sent Items")
+//
+// Each level is decoded from modified UTF-7 and the levels are joined with
+// opts.FolderSeparator. The longest leading part of the hierarchy found in
+// opts.FolderMap is replaced by its target name.
+func MaildirFolder(name string, opts Options) string {
+    sep := opts.FolderSeparator
+    if sep == "" {
+        sep = DefaultFolderSeparator
+    }
+
+    var levels []string
+    for _, l := range strings.Split(strings.TrimPrefix(name, "."), ".") {
+        if l == "" {
+            continue
+        }
+        if dec, err := DecodeModifiedUTF7(l); err == nil {
+            l = dec
+        }
+        levels = append(levels, l)
+    }
+    if len(levels) == 0 {
+        return "INBOX"
+    }
+
+    for n := len(levels); n > 0; n-- {
+        if target, ok := lookupFolder(opts.FolderMap, strings.Join(levels[:n], ".")); ok {
+            return strings.Join(append([]string{target}, levels[n:]...), sep)
+        }
+    }
+    return strings.Join(levels, sep)
+}
+
+// lookupFolder finds a folder in a rename map. Keys are compared without
+// the "INBOX." prefix cPanel's IMAP server shows and may be written in
+// modified UTF-7.
+func lookupFolder(m map[string]string, folder string) (string, bool) {
+    for k, v := range m {
+        if folderKey(k) == folder {
+            return v, true
+        }
+    }
+    return "", false
+}
+
+func folderKey(k string) string {
+    k = strings.TrimPrefix(strings.TrimSpace(k), ".")
+    if len(k) > len("INBOX.") && strings.EqualFold(k[:len("INBOX.")], "INBOX.") {
+        k = k[len("INBOX."):]
+    }
+    var levels []string
+    for _, l := range strings.Split(k, ".") {
+        if dec, err := DecodeModifiedUTF7(l); err == nil {
+            l = dec
+        }
+        levels = append(levels, l)
+    }
+    return strings.Join(levels, ".")
+}
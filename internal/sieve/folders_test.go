@@ -0,0 +1,99 @@
+package sieve
+
+import (
+    "testing"
+)
+
+func TestMaildirFolder(t *testing.T) {
+    renames := Options{FolderMap: map[string]string{
+        "INBOX.Sent":    "Sent Items",
+        "Archive.2023":  "Old/2023",
+        ".&A5MDsQPBA7c-": "Greek",
+    }}
+    dots := Options{FolderSeparator: "."}
+    tests := []struct {
+        name string
+        opts Options
+        want string
+    }{
+        {".Clients.Acme", Options{}, "Clients/Acme"},
+        {"Clients.Acme", Options{}, "Clients/Acme"},
+        {".Clients.Acme", dots, "Clients.Acme"},
+        {".&A5MDsQPBA7cDwQ-", Options{}, "Γαρηρ"},
+        {".Work.&AOk-t&AOk-", Options{}, "Work/été"},
+        {".", Options{}, "INBOX"},
+        {"", Options{}, "INBOX"},
+        {".Sent", renames, "Sent Items"},
+        {".Sent.2024", renames, "Sent Items/2024"},
+        {".Archive.2023.Q1", renames, "Old/2023/Q1"},
+        {".Archive.2024", renames, "Archive/2024"},
+        {".&A5MDsQPBA7c-", renames, "Greek"},
+        {".Sentinel", renames, "Sentinel"},
+        {".Bad&-name", Options{}, "Bad&name"},
+        {".Bad&Zm9v", Options{}, "Bad&Zm9v"},
+    }
+    for _, tt := range tests {
+        if got := MaildirFolder(tt.name, tt.opts); got != tt.want {
+            t.Errorf("MaildirFolder(%q) = %q, want %q", tt.name, got, tt.want)
+        }
+    }
+}
+
+func TestMailboxFromDest(t *testing.T) {
+    renames := Options{FolderMap: map[string]string{"INBOX.Sent": "Sent Items"}}
+    tests := []struct {
+        dest string
+        opts Options
+        want string
+    }{
+        {"", Options{}, "INBOX"},
+        // save paths
+        {"$home/mail/ex.gr/chris/.Nixpal", Options{}, "Nixpal"},
+        {"$home/mail/ex.gr/chris/.Clients.Acme", Options{}, "Clients/Acme"},
+        {"$home/mail/ex.gr/chris/.Clients/.Acme/", Options{}, "Clients/Acme"},
+        {"/home/u/mail/ex.gr/chris/.Sent", renames, "Sent Items"},
+        {"$home/mail/ex.gr/chris/.&A5MDsQPBA7cDwQ-", Options{}, "Γαρηρ"},
+        // paths that are not Maildir++ folders keep their last element
+        {"$home/mail/ex.gr/chris", Options{}, "chris"},
+        {"/var/spool/quarantine/Held.Mail", Options{}, "Held.Mail"},
+        // bare folder names
+        {"INBOX.Sent", renames, "Sent Items"},
+        {"inbox.Sent.2024", renames, "Sent Items/2024"},
+        {"Clients.Acme", Options{}, "Clients/Acme"},
+        {"Nixpal", Options{}, "Nixpal"},
+        {"INBOX", Options{}, "INBOX"},
+        {" INBOX.Lists.Go ", Options{}, "Lists/Go"},
+    }
+    for _, tt := range tests {
+        if got := mailboxFromDest(tt.dest, tt.opts); got != tt.want {
+            t.Errorf("mailboxFromDest(%q) = %q, want %q", tt.dest, got, tt.want)
+        }
+    }
+}
+
+func TestSaveToFolderName(t *testing.T) {
+    opts := DefaultOptions()
+    opts.FolderMap = map[string]string{"INBOX.Sent": "Sent Items"}
+    f := Filter{Filter: []FilterEntry{{
+        Filtername: "Folders",
+        Enabled:    1,
+        Actions: []Action{
+            {Action: "save", Dest: "INBOX.Sent", Unseen: true},
+            {Action: "save", Dest: "Clients.Acme"}, // deliver "$local_part+Clients.Acme@$domain"
+        },
+    }}}
+    scripts, _ := ConvertFilters(f, opts)
+    s, err := ParseScript(scripts[0].Content)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var got []string
+    for _, cmd := range s.Commands {
+        if cmd.Name == "fileinto" {
+            got = append(got, ArgStrings(cmd.Args[len(cmd.Args)-1])...)
+        }
+    }
+    if len(got) != 2 || got[0] != "Sent Items" || got[1] != "Clients/Acme" {
+        t.Errorf("fileinto %q, want Sent Items, Clients/Acme\n%s", got, scripts[0].Content)
+    }
+}
@@ -0,0 +1,263 @@
+package sieve
+
+import (
+    "errors"
+    "fmt"
+    "sort"
+    "strings"
+)
+
+// Severity of a lint finding.
+type Severity string
+
+const (
+    SeverityError   Severity = "error"
+    SeverityWarning Severity = "warning"
+)
+
+// Finding is a single machine-readable lint result.
+type Finding struct {
+    Severity Severity `json:"severity"`
+    Code     string   `json:"code"`
+    Message  string   `json:"message"`
+    Script   string   `json:"script,omitempty"`
+    Line     int      `json:"line,omitempty"`
+    Column   int      `json:"column,omitempty"`
+}
+
+func (f Finding) String() string {
+    loc := f.Script
+    if f.Line > 0 {
+        loc = fmt.Sprintf("%s:%d:%d", loc, f.Line, f.Column)
+    }
+    return fmt.Sprintf("%s: %s: %s [%s]", loc, f.Severity, f.Message, f.Code)
+}
+
+// HasErrors reports whether any finding has error severity.
+func HasErrors(findings []Finding) bool {
+    for _, f := range findings {
+        if f.Severity == SeverityError {
+            return true
+        }
+    }
+    return false
+}
+
+// Lint validates a script offline. The text in Content is parsed again so
+// findings carry line/column positions, also for generated scripts.
+func Lint(sc SieveScript) []Finding {
+    tree, err := ParseScript(sc.Content)
+    if err != nil {
+        f := Finding{
+            Severity: SeverityError,
+            Code:     "syntax",
+            Message:  err.Error(),
+            Script:   sc.Name,
+        }
+        var se *SyntaxError
+        if errors.As(err, &se) {
+            f.Message = se.Msg
+            f.Line, f.Column = se.Pos.Line, se.Pos.Column
+        }
+        return []Finding{f}
+    }
+    return LintScript(sc.Name, tree)
+}
+
+// LintScript checks a parsed script for:
+//   - extensions used but missing from require (error)
+//   - required extensions that are never used (warning)
+//   - converter placeholders "true/false /* TODO ... */" (true matches every
+//     message, so it is an error; false only disables a rule)
+//   - commands that can never run after an unconditional stop (warning)
+func LintScript(name string, s *Script) []Finding {
+    l := &linter{name: name, used: map[string]Pos{}}
+
+    required := map[string]Pos{}
+    for _, c := range s.Commands {
+        if c.Name != "require" {
+            continue
+        }
+        for _, a := range c.Args {
+            for _, ext := range ArgStrings(a) {
+                required[ext] = c.Pos
+            }
+        }
+    }
+
+    l.commands(s.Commands)
+
+    var missing []string
+    for ext := range l.used {
+        if _, ok := required[ext]; !ok {
+            missing = append(missing, ext)
+        }
+    }
+    sort.Strings(missing)
+    for _, ext := range missing {
+        l.add(SeverityError, "missing-require", l.used[ext],
+            fmt.Sprintf("extension %q is used but not listed in require", ext))
+    }
+
+    var unused []string
+    for ext := range required {
+        if _, ok := l.used[ext]; !ok {
+            unused = append(unused, ext)
+        }
+    }
+    sort.Strings(unused)
+    for _, ext := range unused {
+        l.add(SeverityWarning, "unused-require", required[ext],
+            fmt.Sprintf("extension %q is required but never used", ext))
+    }
+
+    return l.findings
+}
+
+type linter struct {
+    name     string
+    used     map[string]Pos // extension -> first use
+    findings []Finding
+}
+
+func (l *linter) add(sev Severity, code string, pos Pos, msg string) {
+    l.findings = append(l.findings, Finding{
+        Severity: sev,
+        Code:     code,
+        Message:  msg,
+        Script:   l.name,
+        Line:     pos.Line,
+        Column:   pos.Column,
+    })
+}
+
+func (l *linter) use(ext string, pos Pos) {
+    if _, ok := l.used[ext]; !ok {
+        l.used[ext] = pos
+    }
+}
+
+func (l *linter) commands(cmds []*Command) {
+    stopped := false
+    for _, c := range cmds {
+        if c.IsComment() {
+            continue
+        }
+        if stopped {
+            l.add(SeverityWarning, "unreachable", c.Pos,
+                fmt.Sprintf("%s can never run: it follows an unconditional stop", c.Name))
+            stopped = false // report only the first unreachable command
+        }
+
+        if ext, ok := commandExtensions[c.Name]; ok {
+            l.use(ext, c.Pos)
+        }
+        l.args(c.Args, c.Pos)
+        if c.Test != nil {
+            l.test(c.Test)
+        }
+        if c.Block != nil {
+            l.commands(c.Block)
+        }
+
+        if c.Name == "stop" || (c.Name == "if" && c.Test != nil && c.Test.Name == "true" &&
+            c.Test.Comment == "" && blockStops(c.Block)) {
+            stopped = true
+        }
+    }
+}
+
+// blockStops reports whether a block always ends processing.
+func blockStops(block []*Command) bool {
+    for _, c := range block {
+        if c.Name == "stop" {
+            return true
+        }
+    }
+    return false
+}
+
+func (l *linter) test(t *Test) {
+    if ext, ok := testExtensions[t.Name]; ok {
+        l.use(ext, t.Pos)
+    }
+    l.args(t.Args, t.Pos)
+
+    if (t.Name == "true" || t.Name == "false") && strings.Contains(t.Comment, "TODO") {
+        sev := SeverityWarning
+        what := "rule never matches"
+        if t.Name == "true" {
+            sev = SeverityError
+            what = "rule matches every message"
+        }
+        l.add(sev, "todo-placeholder", t.Pos,
+            fmt.Sprintf("unconverted placeholder, %s: %s", what, t.Comment))
+    }
+
+    for _, sub := range t.Tests {
+        l.test(sub)
+    }
+}
+
+func (l *linter) args(args []Arg, pos Pos) {
+    for i, a := range args {
+        tag, ok := a.(Tag)
+        if !ok {
+            continue
+        }
+        if ext, ok := tagExtensions[string(tag)]; ok {
+            l.use(ext, pos)
+        }
+        if tag == "comparator" && i+1 < len(args) {
+            for _, cmp := range ArgStrings(args[i+1]) {
+                if cmp != "i;octet" && cmp != "i;ascii-casemap" {
+                    l.use("comparator-"+cmp, pos)
+                }
+            }
+        }
+    }
+}
+
+// Extensions implied by commands, tests and tagged arguments.
+var commandExtensions = map[string]string{
+    "fileinto":     "fileinto",
+    "reject":       "reject",
+    "ereject":      "ereject",
+    "vacation":     "vacation",
+    "set":          "variables",
+    "addheader":    "editheader",
+    "deleteheader": "editheader",
+    "setflag":      "imap4flags",
+    "addflag":      "imap4flags",
+    "removeflag":   "imap4flags",
+    "include":      "include",
+    "return":       "include",
+    "global":       "include",
+    "notify":       "enotify",
+    "pipe":         "vnd.dovecot.pipe",
+    "filter":       "vnd.dovecot.filter",
+    "execute":      "vnd.dovecot.execute",
+}
+
+var testExtensions = map[string]string{
+    "body":          "body",
+    "envelope":      "envelope",
+    "date":          "date",
+    "currentdate":   "date",
+    "string":        "variables",
+    "hasflag":       "imap4flags",
+    "mailboxexists": "mailbox",
+    "spamtest":      "spamtest",
+    "virustest":     "virustest",
+    "duplicate":     "duplicate",
+}
+
+var tagExtensions = map[string]string{
+    "regex":   "regex",
+    "copy":    "copy",
+    "create":  "mailbox",
+    "value":   "relational",
+    "count":   "relational",
+    "seconds": "vacation-seconds",
+    "index":   "index",
+}
@@ -0,0 +1,93 @@
+package sieve
+
+import (
+    "testing"
+)
+
+func TestLintFindings(t *testing.T) {
+    tests := []struct {
+        name  string
+        src   string
+        codes []string // findings in order, "" for none
+        error bool
+    }{
+        {
+            name: "clean",
+            src: `require ["fileinto"];
+if header :contains "Subject" "x" { fileinto "X"; stop; }
+`,
+        },
+        {
+            name: "missing require",
+            src: `if body :contains "x" { discard; }
+`,
+            codes: []string{"missing-require"},
+            error: true,
+        },
+        {
+            name: "comparator and relational",
+            src: `require ["relational"];
+if header :value "gt" :comparator "i;ascii-numeric" "X-Spam-Score" "5" { discard; }
+`,
+            codes: []string{"missing-require"},
+            error: true,
+        },
+        {
+            name: "unused require",
+            src: `require ["fileinto", "copy"];
+fileinto "X";
+`,
+            codes: []string{"unused-require"},
+        },
+        {
+            name: "true placeholder",
+            src: `if true /* TODO: unsupported match "x" */ { discard; }
+`,
+            codes: []string{"todo-placeholder"},
+            error: true,
+        },
+        {
+            name: "false placeholder",
+            src: `if false /* TODO: regex needs the regex extension */ { discard; }
+`,
+            codes: []string{"todo-placeholder"},
+        },
+        {
+            name: "unreachable",
+            src: `stop;
+discard;
+`,
+            codes: []string{"unreachable"},
+        },
+        {
+            name: "syntax",
+            src: `if true { keep;
+`,
+            codes: []string{"syntax"},
+            error: true,
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            findings := Lint(SieveScript{Name: "t.sieve", Content: tt.src})
+            var codes []string
+            for _, f := range findings {
+                codes = append(codes, f.Code)
+                if f.Script != "t.sieve" || (f.Code != "unused-require" && f.Line == 0) {
+                    t.Errorf("finding without position: %s", f)
+                }
+            }
+            if len(codes) != len(tt.codes) {
+                t.Fatalf("findings = %v, want %v", findings, tt.codes)
+            }
+            for i := range codes {
+                if codes[i] != tt.codes[i] {
+                    t.Errorf("finding %d = %s, want %s", i, codes[i], tt.codes[i])
+                }
+            }
+            if HasErrors(findings) != tt.error {
+                t.Errorf("HasErrors = %v, want %v (%v)", HasErrors(findings), tt.error, findings)
+            }
+        })
+    }
+}
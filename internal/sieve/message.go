@@ -0,0 +1,156 @@
+package sieve
+
+import (
+    "bytes"
+    "encoding/base64"
+    "io"
+    "io/ioutil"
+    "mime"
+    "mime/multipart"
+    "mime/quotedprintable"
+    "net/mail"
+    "net/textproto"
+    "strings"
+)
+
+// Message is the input of the simulator: an RFC 5322 message plus the
+// SMTP envelope it was delivered with.
+type Message struct {
+    Name         string // file name, used in reports
+    Header       mail.Header
+    Body         []byte // raw body, still transfer-encoded
+    Size         int    // size of the whole message in octets
+    EnvelopeFrom string
+    EnvelopeTo   string
+}
+
+// ReadMessage loads a .eml file. The envelope is guessed from Return-Path
+// and Delivered-To / X-Original-To / To; callers may override it.
+func ReadMessage(path string) (*Message, error) {
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    m, err := mail.ReadMessage(bytes.NewReader(data))
+    if err != nil {
+        return nil, err
+    }
+    body, err := ioutil.ReadAll(m.Body)
+    if err != nil {
+        return nil, err
+    }
+
+    msg := &Message{
+        Name:   path,
+        Header: m.Header,
+        Body:   body,
+        Size:   len(data),
+    }
+    msg.EnvelopeFrom = firstAddress(m.Header.Get("Return-Path"))
+    for _, h := range []string{"Delivered-To", "X-Original-To", "To"} {
+        if to := firstAddress(m.Header.Get(h)); to != "" {
+            msg.EnvelopeTo = to
+            break
+        }
+    }
+    return msg, nil
+}
+
+// firstAddress returns the bare address of the first mailbox in a header value.
+func firstAddress(v string) string {
+    v = strings.TrimSpace(v)
+    if v == "" {
+        return ""
+    }
+    if list, err := mail.ParseAddressList(v); err == nil && len(list) > 0 {
+        return list[0].Address
+    }
+    return strings.Trim(v, "<> ")
+}
+
+// headerValues returns the decoded values of a header field (RFC 2047
+// encoded words are decoded, as Sieve implementations do).
+func (m *Message) headerValues(name string) []string {
+    raw := m.Header[textproto.CanonicalMIMEHeaderKey(name)]
+    dec := new(mime.WordDecoder)
+    out := make([]string, 0, len(raw))
+    for _, v := range raw {
+        if d, err := dec.DecodeHeader(v); err == nil {
+            v = d
+        }
+        out = append(out, v)
+    }
+    return out
+}
+
+// addressValues returns the addresses found in a header field. Values that
+// do not parse as addresses are returned unchanged.
+func (m *Message) addressValues(name string) []string {
+    var out []string
+    for _, v := range m.Header[textproto.CanonicalMIMEHeaderKey(name)] {
+        list, err := mail.ParseAddressList(v)
+        if err != nil {
+            out = append(out, strings.TrimSpace(v))
+            continue
+        }
+        for _, a := range list {
+            out = append(out, a.Address)
+        }
+    }
+    return out
+}
+
+// bodyText returns the decoded text parts of the message, which is what
+// the body extension's default :text transform looks at.
+func (m *Message) bodyText() string {
+    var b strings.Builder
+    collectText(&b, m.Header.Get("Content-Type"), m.Header.Get("Content-Transfer-Encoding"), m.Body)
+    return b.String()
+}
+
+func collectText(b *strings.Builder, contentType, encoding string, body []byte) {
+    mediaType, params, err := mime.ParseMediaType(contentType)
+    if err != nil {
+        mediaType = "text/plain"
+    }
+
+    if strings.HasPrefix(mediaType, "multipart/") {
+        r := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+        for {
+            part, err := r.NextRawPart()
+            if err != nil {
+                return
+            }
+            data, _ := ioutil.ReadAll(part)
+            collectText(b, part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), data)
+        }
+    }
+    if !strings.HasPrefix(mediaType, "text/") {
+        return
+    }
+
+    var r io.Reader = bytes.NewReader(body)
+    switch strings.ToLower(strings.TrimSpace(encoding)) {
+    case "quoted-printable":
+        r = quotedprintable.NewReader(r)
+    case "base64":
+        r = base64.NewDecoder(base64.StdEncoding, newLineStripper(body))
+    }
+    data, err := ioutil.ReadAll(r)
+    if err != nil {
+        data = body
+    }
+    b.Write(data)
+    b.WriteString("\n")
+}
+
+// newLineStripper drops CR/LF so base64 bodies split over lines decode.
+func newLineStripper(body []byte) io.Reader {
+    clean := bytes.Map(func(r rune) rune {
+        if r == '\r' || r == '\n' {
+            return -1
+        }
+        return r
+    }, body)
+    return bytes.NewReader(clean)
+}
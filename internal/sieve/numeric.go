@@ -0,0 +1,124 @@
+package sieve
+
+import (
+    "fmt"
+    "math"
+    "strconv"
+    "strings"
+)
+
+// ───────────────────────────── Numeric comparisons ─────────────────────────
+
+// numericMatch maps Exim's "is [not] above|below" (and cPanel's match names
+// for them) to a relational operator of the relational extension.
+func numericMatch(match string) (rel string, negative bool, ok bool) {
+    switch match {
+    case "is above", "above":
+        return "gt", false, true
+    case "is not above", "not above":
+        return "gt", true, true
+    case "is below", "below":
+        return "lt", false, true
+    case "is not below", "not below":
+        return "lt", true, true
+    }
+    return "", false, false
+}
+
+// quantifiers are Exim's number suffixes; Sieve's K/M/G are the same powers
+// of 1024.
+var quantifiers = map[string]uint64{"": 1, "K": 1 << 10, "M": 1 << 20, "G": 1 << 30}
+
+// parseNumber reads an Exim number: digits with an optional decimal part
+// and K/M/G suffix, e.g. "512", "1.5M", "5.3". The result is rounded down
+// to an integer, which exact reports. Negative numbers are an error.
+func parseNumber(val string) (n uint64, exact bool, err error) {
+    s := strings.ToUpper(strings.TrimSpace(val))
+    q := ""
+    if s != "" && strings.ContainsAny(s[len(s)-1:], "KMG") {
+        q, s = s[len(s)-1:], s[:len(s)-1]
+    }
+    if strings.HasPrefix(s, "-") {
+        return 0, false, fmt.Errorf("negative number %q", val)
+    }
+    f, err := strconv.ParseFloat(s, 64)
+    if err != nil || math.IsInf(f, 0) || math.IsNaN(f) || f < 0 {
+        return 0, false, fmt.Errorf("%q is not a number", val)
+    }
+    f *= float64(quantifiers[q])
+    return uint64(f), f == math.Floor(f), nil
+}
+
+// sizeNumber writes a byte count with the largest exact quantifier.
+func sizeNumber(n uint64) Number {
+    for _, q := range []string{"G", "M", "K"} {
+        if n != 0 && n%quantifiers[q] == 0 {
+            return Number{Value: n / quantifiers[q], Quantifier: q}
+        }
+    }
+    return Number{Value: n}
+}
+
+// numeric converts "is above/below" val on $message_size to size
+// :over/:under, and on a header to a relational :value test with
+// i;ascii-numeric.
+func (c *converter) numeric(r *Rule, field fieldInfo, val, rel string, negative bool) *Test {
+    blocked := func(format string, args ...interface{}) *Test {
+        msg := fmt.Sprintf(format, args...)
+        c.report.add(c.filter, ReportBlocking, "", "%s: %s; the rule never matches", ruleText(r), msg)
+        return placeholderTest(false, "TODO: "+msg)
+    }
+
+    n, exact, err := parseNumber(val)
+    if err != nil {
+        return blocked("%v cannot be compared", err)
+    }
+
+    var cond *Test
+    switch {
+    case field.kind == fieldSize:
+        if !exact {
+            c.report.add(c.filter, ReportApprox, "", "%s: the size is rounded down to %d bytes", ruleText(r), n)
+        }
+        over := "over"
+        if rel == "lt" {
+            over = "under"
+        }
+        cond = NewTest("size", Tag(over), sizeNumber(n))
+    case field.kind == fieldHeader && field.addressPart == "":
+        if !c.opts.Profile.Has("relational") || !c.opts.Profile.Has("comparator-i;ascii-numeric") {
+            c.degrade("relational", "%s cannot be compared as a number; it never matches", ruleText(r))
+            return placeholderTest(false, fmt.Sprintf(
+                "TODO: %s needs the relational extension", ruleText(r),
+            ))
+        }
+        if !exact {
+            c.report.add(c.filter, ReportApprox, "",
+                "%s: i;ascii-numeric compares whole numbers; %s is tested as %d and the header's decimals are ignored",
+                ruleText(r), strings.TrimSpace(val), n)
+        }
+        c.used["relational"] = true
+        c.used["comparator-i;ascii-numeric"] = true
+        cond = NewTest("header",
+            Tag("value"), String(rel), Tag("comparator"), String("i;ascii-numeric"),
+            field.headerArg(), String(strconv.FormatUint(n, 10)),
+        )
+
+        // i;ascii-numeric reads a value without leading digits, such as a
+        // negative score, as infinity: keep "-" values out of "gt" and
+        // count them as below anything.
+        minus := NewTest("header", Tag("matches"), field.headerArg(), String("-*"))
+        if rel == "gt" {
+            cond = &Test{Name: "allof", Tests: []*Test{negate(minus), cond}}
+        } else {
+            cond = &Test{Name: "anyof", Tests: []*Test{minus, cond}}
+        }
+    default:
+        return blocked("numeric comparisons only convert on $message_size or a header")
+    }
+
+    if negative {
+        cond = negate(cond)
+    }
+    return cond
+}
@@ -0,0 +1,551 @@
+package sieve
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+)
+
+// SyntaxError is a Sieve parse error with the position where it occurred.
+type SyntaxError struct {
+    Pos Pos
+    Msg string
+}
+
+func (e *SyntaxError) Error() string {
+    return fmt.Sprintf("line %d, column %d: %s", e.Pos.Line, e.Pos.Column, e.Msg)
+}
+
+// ParseScript parses Sieve source text (RFC 5228) into the same syntax tree
+// the converter produces. Hash comments are kept as the Comments of the
+// following command; a bracket comment right before or after a test
+// becomes its LeadingComment or Comment. Other bracket comments are
+// dropped.
+func ParseScript(src string) (*Script, error) {
+    toks, err := lex(src)
+    if err != nil {
+        return nil, err
+    }
+    p := &parser{toks: toks}
+    cmds, err := p.commands(false)
+    if err != nil {
+        return nil, err
+    }
+    return &Script{Commands: cmds}, nil
+}
+
+// ─────────────────────────────── Lexer ────────────────────────────────
+
+type tokenKind int
+
+const (
+    tokEOF tokenKind = iota
+    tokIdent
+    tokTag
+    tokNumber
+    tokString
+    tokHashComment
+    tokBracketComment
+    tokPunct // one of [ ] ( ) , ; { }
+)
+
+type token struct {
+    kind tokenKind
+    text string // identifier/tag name, decoded string, comment text, punct
+    num  Number
+    pos  Pos
+}
+
+type lexer struct {
+    src  string
+    off  int
+    line int
+    col  int
+}
+
+func lex(src string) ([]token, error) {
+    l := &lexer{src: src, line: 1, col: 1}
+    var toks []token
+    for {
+        t, err := l.next()
+        if err != nil {
+            return nil, err
+        }
+        toks = append(toks, t)
+        if t.kind == tokEOF {
+            return toks, nil
+        }
+    }
+}
+
+func (l *lexer) pos() Pos {
+    return Pos{Line: l.line, Column: l.col}
+}
+
+func (l *lexer) errorf(pos Pos, format string, args ...interface{}) error {
+    return &SyntaxError{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (l *lexer) peek() rune {
+    if l.off >= len(l.src) {
+        return -1
+    }
+    r, _ := utf8.DecodeRuneInString(l.src[l.off:])
+    return r
+}
+
+func (l *lexer) advance() rune {
+    r, size := utf8.DecodeRuneInString(l.src[l.off:])
+    l.off += size
+    if r == '\n' {
+        l.line++
+        l.col = 1
+    } else {
+        l.col++
+    }
+    return r
+}
+
+func (l *lexer) next() (token, error) {
+    // Skip whitespace
+    for l.off < len(l.src) && strings.ContainsRune(" \t\r\n", l.peek()) {
+        l.advance()
+    }
+    start := l.pos()
+    if l.off >= len(l.src) {
+        return token{kind: tokEOF, pos: start}, nil
+    }
+
+    r := l.peek()
+    switch {
+    case r == '#':
+        l.advance()
+        begin := l.off
+        for l.off < len(l.src) && l.peek() != '\n' {
+            l.advance()
+        }
+        text := strings.TrimRight(l.src[begin:l.off], "\r")
+        text = strings.TrimPrefix(text, " ")
+        return token{kind: tokHashComment, text: text, pos: start}, nil
+
+    case r == '/' && strings.HasPrefix(l.src[l.off:], "/*"):
+        l.advance()
+        l.advance()
+        end := strings.Index(l.src[l.off:], "*/")
+        if end < 0 {
+            return token{}, l.errorf(start, "unterminated bracket comment")
+        }
+        text := l.src[l.off : l.off+end]
+        for l.off < len(l.src) && !strings.HasPrefix(l.src[l.off:], "*/") {
+            l.advance()
+        }
+        l.advance()
+        l.advance()
+        return token{kind: tokBracketComment, text: strings.TrimSpace(text), pos: start}, nil
+
+    case r == '"':
+        s, err := l.quoted(start)
+        if err != nil {
+            return token{}, err
+        }
+        return token{kind: tokString, text: s, pos: start}, nil
+
+    case r == ':':
+        l.advance()
+        name := l.identifier()
+        if name == "" {
+            return token{}, l.errorf(start, "expected tag name after ':'")
+        }
+        return token{kind: tokTag, text: name, pos: start}, nil
+
+    case r >= '0' && r <= '9':
+        return l.number(start)
+
+    case isIdentStart(r):
+        name := l.identifier()
+        if strings.EqualFold(name, "text") && l.peek() == ':' {
+            l.advance()
+            s, err := l.multiline(start)
+            if err != nil {
+                return token{}, err
+            }
+            return token{kind: tokString, text: s, pos: start}, nil
+        }
+        return token{kind: tokIdent, text: name, pos: start}, nil
+
+    case strings.ContainsRune("[](),;{}", r):
+        l.advance()
+        return token{kind: tokPunct, text: string(r), pos: start}, nil
+    }
+
+    return token{}, l.errorf(start, "unexpected character %q", r)
+}
+
+func isIdentStart(r rune) bool {
+    return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+func (l *lexer) identifier() string {
+    begin := l.off
+    for l.off < len(l.src) {
+        r := l.peek()
+        if !isIdentStart(r) && !(r >= '0' && r <= '9') {
+            break
+        }
+        l.advance()
+    }
+    return l.src[begin:l.off]
+}
+
+func (l *lexer) number(start Pos) (token, error) {
+    begin := l.off
+    for l.off < len(l.src) && l.peek() >= '0' && l.peek() <= '9' {
+        l.advance()
+    }
+    v, err := strconv.ParseUint(l.src[begin:l.off], 10, 64)
+    if err != nil {
+        return token{}, l.errorf(start, "invalid number %q", l.src[begin:l.off])
+    }
+    n := Number{Value: v}
+    switch l.peek() {
+    case 'K', 'k', 'M', 'm', 'G', 'g':
+        n.Quantifier = strings.ToUpper(string(l.advance()))
+    }
+    return token{kind: tokNumber, num: n, pos: start}, nil
+}
+
+// quoted reads a "..." string. Only \\ and \" are defined escapes; for any
+// other character the backslash is dropped (RFC 5228 §2.4.2).
+func (l *lexer) quoted(start Pos) (string, error) {
+    l.advance() // opening quote
+    var b strings.Builder
+    for {
+        if l.off >= len(l.src) {
+            return "", l.errorf(start, "unterminated string")
+        }
+        r := l.advance()
+        switch r {
+        case '"':
+            return b.String(), nil
+        case '\\':
+            if l.off >= len(l.src) {
+                return "", l.errorf(start, "unterminated string")
+            }
+            b.WriteRune(l.advance())
+        default:
+            b.WriteRune(r)
+        }
+    }
+}
+
+// multiline reads the body of a text: string up to the terminating "." line.
+func (l *lexer) multiline(start Pos) (string, error) {
+    // Rest of the "text:" line may only hold whitespace and a hash comment.
+    for l.off < len(l.src) && (l.peek() == ' ' || l.peek() == '\t') {
+        l.advance()
+    }
+    if l.peek() == '#' {
+        for l.off < len(l.src) && l.peek() != '\n' {
+            l.advance()
+        }
+    }
+    if l.peek() == '\r' {
+        l.advance()
+    }
+    if l.peek() != '\n' {
+        return "", l.errorf(l.pos(), "expected end of line after text:")
+    }
+    l.advance()
+
+    var b strings.Builder
+    for {
+        if l.off >= len(l.src) {
+            return "", l.errorf(start, "unterminated multi-line string")
+        }
+        begin := l.off
+        for l.off < len(l.src) && l.peek() != '\n' {
+            l.advance()
+        }
+        line := strings.TrimSuffix(l.src[begin:l.off], "\r")
+        if l.off < len(l.src) {
+            l.advance()
+        }
+        if line == "." {
+            return b.String(), nil
+        }
+        line = strings.TrimPrefix(line, ".") // dot-stuffing
+        b.WriteString(line)
+        b.WriteString("\n")
+    }
+}
+
+// ─────────────────────────────── Parser ───────────────────────────────
+
+type parser struct {
+    toks    []token
+    i       int
+    last    int      // index of the last consumed token
+    pending []string // hash comments waiting for the next command
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+    return &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// peek returns the next significant token, collecting hash comments and
+// skipping bracket comments on the way.
+func (p *parser) peek() token {
+    for {
+        t := p.toks[p.i]
+        switch t.kind {
+        case tokHashComment:
+            p.pending = append(p.pending, t.text)
+            p.i++
+        case tokBracketComment:
+            p.i++
+        default:
+            return t
+        }
+    }
+}
+
+func (p *parser) next() token {
+    t := p.peek()
+    if t.kind != tokEOF {
+        p.last = p.i
+        p.i++
+    }
+    return t
+}
+
+func (p *parser) isPunct(t token, s string) bool {
+    return t.kind == tokPunct && t.text == s
+}
+
+func (p *parser) expect(s string) (token, error) {
+    t := p.next()
+    if !p.isPunct(t, s) {
+        return t, p.errorf(t, "expected %q, found %s", s, describe(t))
+    }
+    return t, nil
+}
+
+func describe(t token) string {
+    switch t.kind {
+    case tokEOF:
+        return "end of script"
+    case tokIdent:
+        return fmt.Sprintf("identifier %q", t.text)
+    case tokTag:
+        return fmt.Sprintf("tag :%s", t.text)
+    case tokNumber:
+        return fmt.Sprintf("number %d%s", t.num.Value, t.num.Quantifier)
+    case tokString:
+        return fmt.Sprintf("string %q", t.text)
+    }
+    return fmt.Sprintf("%q", t.text)
+}
+
+// takeComments hands the collected hash comments to a command.
+func (p *parser) takeComments() []string {
+    c := p.pending
+    p.pending = nil
+    return c
+}
+
+// commands parses commands until end of script, or until "}" when inBlock.
+func (p *parser) commands(inBlock bool) ([]*Command, error) {
+    cmds := []*Command{}
+    for {
+        t := p.peek()
+        if t.kind == tokEOF || (inBlock && p.isPunct(t, "}")) {
+            if t.kind == tokEOF && inBlock {
+                return nil, p.errorf(t, "missing \"}\" at end of block")
+            }
+            if len(p.pending) > 0 {
+                cmds = append(cmds, CommentBlock(p.takeComments()...))
+            }
+            return cmds, nil
+        }
+        c, err := p.command()
+        if err != nil {
+            return nil, err
+        }
+        cmds = append(cmds, c)
+    }
+}
+
+func (p *parser) command() (*Command, error) {
+    t := p.next()
+    if t.kind != tokIdent {
+        return nil, p.errorf(t, "expected command, found %s", describe(t))
+    }
+    c := &Command{Name: strings.ToLower(t.text), Comments: p.takeComments(), Pos: t.pos}
+
+    args, test, err := p.arguments()
+    if err != nil {
+        return nil, err
+    }
+    c.Args = args
+    if len(test) == 1 {
+        c.Test = test[0]
+        c.Test.LineComment = p.lineComment()
+    } else if len(test) > 1 {
+        return nil, p.errorf(t, "command %s does not take a test list", c.Name)
+    }
+
+    switch c.Name {
+    case "if", "elsif":
+        if c.Test == nil {
+            return nil, p.errorf(t, "%s requires a test", c.Name)
+        }
+    }
+
+    end := p.next()
+    switch {
+    case p.isPunct(end, ";"):
+        if c.HasBlock() {
+            return nil, p.errorf(end, "%s requires a block", c.Name)
+        }
+        return c, nil
+    case p.isPunct(end, "{"):
+        block, err := p.commands(true)
+        if err != nil {
+            return nil, err
+        }
+        if _, err := p.expect("}"); err != nil {
+            return nil, err
+        }
+        c.Block = block
+        return c, nil
+    }
+    return nil, p.errorf(end, "expected \";\" or block after %s, found %s", c.Name, describe(end))
+}
+
+// arguments parses *argument [test / test-list]. A single test is returned
+// as a one-element slice; a parenthesised list is only valid for tests.
+func (p *parser) arguments() ([]Arg, []*Test, error) {
+    var args []Arg
+    for {
+        t := p.peek()
+        switch {
+        case t.kind == tokTag:
+            p.next()
+            args = append(args, Tag(strings.ToLower(t.text)))
+        case t.kind == tokNumber:
+            p.next()
+            args = append(args, t.num)
+        case t.kind == tokString:
+            p.next()
+            args = append(args, String(t.text))
+        case p.isPunct(t, "["):
+            list, err := p.stringList()
+            if err != nil {
+                return nil, nil, err
+            }
+            args = append(args, list)
+        case t.kind == tokIdent:
+            test, err := p.test()
+            if err != nil {
+                return nil, nil, err
+            }
+            return args, []*Test{test}, nil
+        case p.isPunct(t, "("):
+            tests, err := p.testList()
+            if err != nil {
+                return nil, nil, err
+            }
+            return args, tests, nil
+        default:
+            return args, nil, nil
+        }
+    }
+}
+
+func (p *parser) stringList() (StringList, error) {
+    p.next() // "["
+    list := StringList{}
+    for {
+        t := p.next()
+        if t.kind != tokString {
+            return nil, p.errorf(t, "expected string in string list, found %s", describe(t))
+        }
+        list = append(list, t.text)
+        sep := p.next()
+        if p.isPunct(sep, "]") {
+            return list, nil
+        }
+        if !p.isPunct(sep, ",") {
+            return nil, p.errorf(sep, "expected \",\" or \"]\" in string list, found %s", describe(sep))
+        }
+    }
+}
+
+func (p *parser) testList() ([]*Test, error) {
+    p.next() // "("
+    var tests []*Test
+    for {
+        t, err := p.test()
+        if err != nil {
+            return nil, err
+        }
+        tests = append(tests, t)
+        sep := p.next()
+        if p.isPunct(sep, ")") {
+            return tests, nil
+        }
+        if !p.isPunct(sep, ",") {
+            return nil, p.errorf(sep, "expected \",\" or \")\" in test list, found %s", describe(sep))
+        }
+    }
+}
+
+func (p *parser) test() (*Test, error) {
+    prev := p.last
+    t := p.next()
+    if t.kind != tokIdent {
+        return nil, p.errorf(t, "expected test, found %s", describe(t))
+    }
+    test := &Test{Name: strings.ToLower(t.text), Pos: t.pos}
+    for i := prev + 1; i < p.last; i++ {
+        if p.toks[i].kind == tokBracketComment {
+            test.LeadingComment = p.toks[i].text
+        }
+    }
+
+    args, sub, err := p.arguments()
+    if err != nil {
+        return nil, err
+    }
+    test.Args = args
+    test.Tests = sub
+
+    // A bracket comment directly after the test belongs to it, e.g. the
+    // converter's false /* TODO ... */ placeholders. It is consumed, so
+    // enclosing tests (not, anyof) do not take it as well.
+    if after := p.toks[p.last+1]; after.kind == tokBracketComment {
+        test.Comment = after.text
+        p.last++
+        if p.i <= p.last {
+            p.i = p.last + 1
+        }
+    }
+    return test, nil
+}
+
+// lineComment takes a hash comment on the same line as the last consumed
+// token, as in Roundcube's "if false # ..." disabled rules.
+func (p *parser) lineComment() string {
+    after := p.toks[p.last+1]
+    if after.kind != tokHashComment || after.pos.Line != p.toks[p.last].pos.Line {
+        return ""
+    }
+    if p.i == p.last+1 {
+        p.i++
+    } else {
+        // Already collected by peek; it is the first pending comment.
+        p.pending = p.pending[1:]
+    }
+    return after.text
+}
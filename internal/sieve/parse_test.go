@@ -0,0 +1,145 @@
+package sieve
+
+import (
+    "strings"
+    "testing"
+)
+
+// roundTripScripts cover the syntax the converter and the importers read
+// back: comments, escapes, multi-line strings, lists, numbers and nesting.
+var roundTripScripts = map[string]string{
+    "require and fileinto": `require ["fileinto", "mailbox"];
+fileinto :create "Lists/Go";
+`,
+    "comments": `# rule:[Boss]
+# Filter: Boss
+if address :is "From" "boss@ex.gr" { # inline
+    /* bracket
+       comment */
+    fileinto "Boss";
+    stop;
+}
+`,
+    "escapes": `if header :contains "Subject" "say \"hi\" \\ bye" {
+    discard;
+}
+`,
+    "multi-line string": "require \"vacation\";\nvacation :days 7 :subject \"Away\" text:\nI am away.\n..leading dot\n.\n;\n",
+    "nesting": `require ["envelope", "relational", "comparator-i;ascii-numeric"];
+if anyof (
+    allof (
+        not exists "Reply-To",
+        envelope :localpart :is "to" "info"
+    ),
+    header :value "gt" :comparator "i;ascii-numeric" ["X-Spam-Score", "X-Rspamd-Score"] "5"
+) {
+    keep;
+} elsif size :over 10M {
+    discard;
+} else {
+    stop;
+}
+`,
+    "placeholder": `if false /* TODO: body test contains "x" needs the body extension */ {
+    keep;
+}
+`,
+    "comment after negated test": `if not header :is "a" "b" /* c */ {
+    keep;
+}
+`,
+    "comment before test in list": `if anyof (
+    /* a */ header :is "a" "b",
+    /* d */ exists "x" /* e */
+) {
+    keep;
+}
+`,
+}
+
+func TestParsePrintRoundTrip(t *testing.T) {
+    for name, src := range roundTripScripts {
+        t.Run(name, func(t *testing.T) {
+            first, err := ParseScript(src)
+            if err != nil {
+                t.Fatalf("parse: %v", err)
+            }
+            printed := first.String()
+            second, err := ParseScript(printed)
+            if err != nil {
+                t.Fatalf("parse of printed script: %v\n%s", err, printed)
+            }
+            if again := second.String(); again != printed {
+                t.Errorf("print is not stable:\n--- first\n%s--- second\n%s", printed, again)
+            }
+        })
+    }
+}
+
+func TestParseKeepsValues(t *testing.T) {
+    s, err := ParseScript(roundTripScripts["escapes"] + roundTripScripts["nesting"])
+    if err != nil {
+        t.Fatal(err)
+    }
+    key := ArgStrings(s.Commands[0].Test.Args[2])
+    if len(key) != 1 || key[0] != `say "hi" \ bye` {
+        t.Errorf("escaped string = %q", key)
+    }
+    size := s.Commands[3].Test // elsif size :over 10M
+    if s.Commands[3].Name != "elsif" || size == nil || size.Name != "size" {
+        t.Fatalf("elsif test = %+v", size)
+    }
+    if n, ok := size.Args[1].(Number); !ok || n.Value != 10 || n.Quantifier != "M" {
+        t.Errorf("size limit = %#v", size.Args[1])
+    }
+}
+
+// TestParseBracketComments checks that each bracket comment is printed
+// once, next to the test it was written at.
+func TestParseBracketComments(t *testing.T) {
+    for _, name := range []string{"comment after negated test", "comment before test in list"} {
+        s, err := ParseScript(roundTripScripts[name])
+        if err != nil {
+            t.Fatal(err)
+        }
+        if got := s.String(); got != roundTripScripts[name] {
+            t.Errorf("%s: printed\n%s", name, got)
+        }
+    }
+    flat, err := ParseScript(`if anyof (/* a */ header :is "a" "b", exists "x") { keep; }`)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got := flat.Commands[0].Test.Tests[0].LeadingComment; got != "a" {
+        t.Errorf("leading comment = %q", got)
+    }
+
+    s, err := ParseScript(roundTripScripts["comment after negated test"])
+    if err != nil {
+        t.Fatal(err)
+    }
+    not := s.Commands[0].Test
+    if not.Comment != "" || not.Tests[0].Comment != "c" {
+        t.Errorf("comment on not = %q, on header = %q; want it on header only", not.Comment, not.Tests[0].Comment)
+    }
+}
+
+func TestParseErrors(t *testing.T) {
+    for _, src := range []string{
+        `if true { keep;`,
+        `fileinto "x"`,
+        `if header :is "a" {`,
+        `"unterminated`,
+        `/* open comment`,
+    } {
+        _, err := ParseScript(src)
+        if err == nil {
+            t.Errorf("ParseScript(%q) succeeded", src)
+            continue
+        }
+        se, ok := err.(*SyntaxError)
+        if !ok || se.Pos.Line == 0 || !strings.HasPrefix(err.Error(), "line ") {
+            t.Errorf("ParseScript(%q) = %v, want a positioned SyntaxError", src, err)
+        }
+    }
+}
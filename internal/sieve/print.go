@@ -0,0 +1,223 @@
+package sieve
+
+import (
+    "fmt"
+    "strings"
+)
+
+const indentUnit = "    "
+
+// String renders the script in the canonical layout used for every
+// generated .sieve file:
+//
+//   require ["fileinto"];
+//
+//   # comment
+//   if anyof (
+//       header :contains "Subject" "x",
+//       address :is "From" "y"
+//   ) {
+//       fileinto "X";
+//       stop;
+//   }
+func (s *Script) String() string {
+    var p printer
+    p.commands(s.Commands, 0)
+    return p.b.String()
+}
+
+// String renders a single test on one logical line (nested lists still
+// break across lines).
+func (t *Test) String() string {
+    var p printer
+    return p.test(t, 0)
+}
+
+// OneLine renders a test with its lists on a single line, as needed after
+// a hash comment.
+func (t *Test) OneLine() string {
+    p := printer{flat: true}
+    return p.test(t, 0)
+}
+
+type printer struct {
+    b    strings.Builder
+    flat bool // keep test lists on one line
+}
+
+func (p *printer) commands(cmds []*Command, depth int) {
+    for i, c := range cmds {
+        if depth == 0 && i > 0 && needsBlankLine(cmds[i-1], c) {
+            p.b.WriteString("\n")
+        }
+        p.command(c, depth)
+    }
+}
+
+// needsBlankLine decides the vertical spacing between top-level commands.
+func needsBlankLine(prev, cur *Command) bool {
+    switch {
+    case cur.Name == "elsif" || cur.Name == "else":
+        return false
+    case prev.Name == "require":
+        return cur.Name != "require"
+    }
+    return prev.HasBlock() || prev.IsComment() || cur.HasBlock() || len(cur.Comments) > 0
+}
+
+func (p *printer) command(c *Command, depth int) {
+    ind := strings.Repeat(indentUnit, depth)
+
+    for _, line := range c.Comments {
+        p.b.WriteString(ind)
+        p.b.WriteString(commentLine(line))
+        p.b.WriteString("\n")
+    }
+    if c.IsComment() {
+        return
+    }
+
+    p.b.WriteString(ind)
+    p.b.WriteString(c.Name)
+    for i, a := range c.Args {
+        last := i == len(c.Args)-1 && c.Test == nil && !c.HasBlock()
+        if s, ok := a.(String); ok && last && strings.Contains(string(s), "\n") {
+            // Multi-line strings are only safe as the final argument, where
+            // the terminating "." line can be followed by the semicolon.
+            p.b.WriteString(" ")
+            p.b.WriteString(multilineString(string(s)))
+            p.b.WriteString(";\n")
+            return
+        }
+        p.b.WriteString(" ")
+        p.b.WriteString(formatArg(a))
+    }
+    if c.Test != nil {
+        p.b.WriteString(" ")
+        p.b.WriteString(p.test(c.Test, depth))
+    }
+
+    if !c.HasBlock() {
+        p.b.WriteString(";\n")
+        return
+    }
+    if c.Test != nil && c.Test.LineComment != "" {
+        // The comment runs to the end of the line; the brace follows below.
+        p.b.WriteString(" ")
+        p.b.WriteString(commentLine(c.Test.LineComment))
+        p.b.WriteString("\n")
+        p.b.WriteString(ind)
+        p.b.WriteString("{\n")
+    } else {
+        p.b.WriteString(" {\n")
+    }
+    p.commands(c.Block, depth+1)
+    p.b.WriteString(ind)
+    p.b.WriteString("}\n")
+}
+
+func (p *printer) test(t *Test, depth int) string {
+    var b strings.Builder
+    if t.LeadingComment != "" {
+        b.WriteString("/* ")
+        b.WriteString(strings.ReplaceAll(t.LeadingComment, "*/", "* /"))
+        b.WriteString(" */ ")
+    }
+    b.WriteString(t.Name)
+    for _, a := range t.Args {
+        b.WriteString(" ")
+        b.WriteString(formatArg(a))
+    }
+
+    switch {
+    case t.Name == "not" && len(t.Tests) == 1:
+        b.WriteString(" ")
+        b.WriteString(p.test(t.Tests[0], depth))
+    case len(t.Tests) == 1:
+        b.WriteString(" (")
+        b.WriteString(p.test(t.Tests[0], depth))
+        b.WriteString(")")
+    case len(t.Tests) > 1 && p.flat:
+        b.WriteString(" (")
+        for i, sub := range t.Tests {
+            if i > 0 {
+                b.WriteString(", ")
+            }
+            b.WriteString(p.test(sub, depth))
+        }
+        b.WriteString(")")
+    case len(t.Tests) > 1:
+        inner := strings.Repeat(indentUnit, depth+1)
+        b.WriteString(" (\n")
+        for i, sub := range t.Tests {
+            b.WriteString(inner)
+            b.WriteString(p.test(sub, depth+1))
+            if i < len(t.Tests)-1 {
+                b.WriteString(",")
+            }
+            b.WriteString("\n")
+        }
+        b.WriteString(strings.Repeat(indentUnit, depth))
+        b.WriteString(")")
+    }
+
+    if t.Comment != "" {
+        b.WriteString(" /* ")
+        b.WriteString(strings.ReplaceAll(t.Comment, "*/", "* /"))
+        b.WriteString(" */")
+    }
+    return b.String()
+}
+
+func formatArg(a Arg) string {
+    switch v := a.(type) {
+    case Tag:
+        return ":" + string(v)
+    case Number:
+        return fmt.Sprintf("%d%s", v.Value, v.Quantifier)
+    case String:
+        return quoteString(string(v))
+    case StringList:
+        parts := make([]string, 0, len(v))
+        for _, s := range v {
+            parts = append(parts, quoteString(s))
+        }
+        return "[" + strings.Join(parts, ", ") + "]"
+    }
+    return ""
+}
+
+// commentLine renders one hash comment line; embedded newlines would end
+// the comment early, so they are flattened.
+func commentLine(s string) string {
+    s = strings.ReplaceAll(s, "\r", " ")
+    s = strings.ReplaceAll(s, "\n", " ")
+    if s == "" {
+        return "#"
+    }
+    return "# " + s
+}
+
+// quoteString escapes a Go string into a Sieve double-quoted string
+func quoteString(s string) string {
+    s = strings.ReplaceAll(s, `\`, `\\`)
+    s = strings.ReplaceAll(s, `"`, `\"`)
+    return `"` + s + `"`
+}
+
+// multilineString renders s as a Sieve text: block (RFC 5228 §2.4.2),
+// dot-stuffing lines that start with ".".
+func multilineString(s string) string {
+    var b strings.Builder
+    b.WriteString("text:\n")
+    for _, line := range strings.Split(strings.TrimSuffix(s, "\n"), "\n") {
+        line = strings.TrimSuffix(line, "\r")
+        if strings.HasPrefix(line, ".") {
+            b.WriteString(".")
+        }
+        b.WriteString(line)
+        b.WriteString("\n")
+    }
+    b.WriteString(".\n")
+    return b.String()
+}
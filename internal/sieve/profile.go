@@ -0,0 +1,128 @@
+package sieve
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+)
+
+// Profile describes what the target Sieve implementation accepts in user
+// scripts. The converter consults it before using an extension and falls
+// back (or reports) when the extension is missing.
+type Profile struct {
+    Name         string
+    Extensions   map[string]bool
+    MaxRedirects int // sieve_max_redirects on the target; 0 = no limit known
+}
+
+// DefaultProfileName is used when no [sieve] profile is configured.
+const DefaultProfileName = "pigeonhole-0.5"
+
+// pigeonholeDefaults are the extensions Pigeonhole 0.5 enables for user
+// scripts out of the box (sieve_extensions default).
+var pigeonholeDefaults = []string{
+    "fileinto", "reject", "ereject", "envelope", "encoded-character",
+    "vacation", "subaddress", "comparator-i;ascii-numeric", "relational",
+    "regex", "imap4flags", "copy", "include", "body", "variables",
+    "enotify", "environment", "mailbox", "date", "index", "ihave",
+    "duplicate", "mime", "foreverypart", "extracttext",
+}
+
+// builtinProfiles are the named profiles selectable with [sieve] profile.
+var builtinProfiles = map[string]Profile{
+    "pigeonhole-0.5": {
+        Extensions:   extensionSet(pigeonholeDefaults),
+        MaxRedirects: 4,
+    },
+    // Mailcow adds vacation-seconds and editheader for user scripts;
+    // vnd.dovecot.pipe is only enabled for global scripts there.
+    "mailcow": {
+        Extensions:   extensionSet(pigeonholeDefaults, "vacation-seconds", "editheader"),
+        MaxRedirects: 4,
+    },
+    // Extensions Roundcube's managesieve editor can display and edit.
+    "roundcube-safe": {
+        Extensions: extensionSet([]string{
+            "fileinto", "reject", "ereject", "envelope", "vacation",
+            "relational", "comparator-i;ascii-numeric", "regex", "body",
+            "copy", "imap4flags", "variables", "date", "mailbox",
+        }),
+        MaxRedirects: 4,
+    },
+    "stalwart": {
+        Extensions: extensionSet(pigeonholeDefaults, "vacation-seconds", "editheader",
+            "spamtest", "spamtestplus", "virustest"),
+    },
+}
+
+func extensionSet(base []string, extra ...string) map[string]bool {
+    set := map[string]bool{}
+    for _, ext := range append(append([]string{}, base...), extra...) {
+        set[ext] = true
+    }
+    return set
+}
+
+// ProfileNames lists the built-in profile names.
+func ProfileNames() []string {
+    var names []string
+    for n := range builtinProfiles {
+        names = append(names, n)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// ResolveProfile returns the named profile adjusted by extra. Entries of
+// extra look like "+editheader" / "-regex"; plain names replace the profile's
+// list altogether, so "fileinto, reject" describes a minimal server.
+func ResolveProfile(name string, extra []string, maxRedirects int) (Profile, error) {
+    if name == "" {
+        name = DefaultProfileName
+    }
+    base, ok := builtinProfiles[strings.ToLower(name)]
+    if !ok {
+        return Profile{}, fmt.Errorf("unknown sieve profile %q (known: %s)",
+            name, strings.Join(ProfileNames(), ", "))
+    }
+
+    p := Profile{
+        Name:         strings.ToLower(name),
+        Extensions:   map[string]bool{},
+        MaxRedirects: base.MaxRedirects,
+    }
+    for ext := range base.Extensions {
+        p.Extensions[ext] = true
+    }
+
+    for _, e := range extra {
+        e = strings.TrimSpace(e)
+        if e != "" && e[0] != '+' && e[0] != '-' {
+            p.Extensions = map[string]bool{}
+            p.Name += " (custom)"
+            break
+        }
+    }
+    for _, e := range extra {
+        e = strings.TrimSpace(e)
+        switch {
+        case e == "":
+        case e[0] == '-':
+            delete(p.Extensions, e[1:])
+        case e[0] == '+':
+            p.Extensions[e[1:]] = true
+        default:
+            p.Extensions[e] = true
+        }
+    }
+
+    if maxRedirects > 0 {
+        p.MaxRedirects = maxRedirects
+    }
+    return p, nil
+}
+
+// Has reports whether the target supports an extension.
+func (p Profile) Has(ext string) bool {
+    return p.Extensions[ext]
+}
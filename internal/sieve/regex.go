@@ -0,0 +1,287 @@
+package sieve
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+// translateRegex rewrites an Exim (PCRE) pattern into the POSIX extended
+// regular expression dialect of the Sieve :regex extension
+// (draft-ietf-sieve-regex, as implemented by Pigeonhole).
+//
+// Rewritten constructs:
+//   \d \w \s (and \D \W \S)   -> [0-9], [[:alnum:]_], [[:space:]] (negated)
+//   (?:...) and named groups  -> plain (...) groups
+//   lazy quantifiers *? +? ?? -> greedy: a boolean match does not depend on it
+//   leading (?i)              -> dropped, the default comparator is case-insensitive
+//   \A, \z, \Z                -> ^, $
+//   \n \t \r \xHH             -> the literal character
+//
+// Constructs ERE cannot express (lookarounds, backreferences, \b, possessive
+// quantifiers, inline flags other than a leading (?i), \p{...}, ...) return
+// an error naming the construct.
+func translateRegex(pcre string) (string, error) {
+    var b strings.Builder
+    afterQuantifier := false
+
+    for i := 0; i < len(pcre); i++ {
+        ch := pcre[i]
+        wasQuantifier := afterQuantifier
+        afterQuantifier = false
+
+        switch ch {
+        case '\\':
+            if i+1 >= len(pcre) {
+                return "", fmt.Errorf("trailing backslash")
+            }
+            i++
+            out, n, err := translateEscape(pcre[i:], false)
+            if err != nil {
+                return "", err
+            }
+            i += n - 1
+            b.WriteString(out)
+
+        case '[':
+            out, n, err := translateBracket(pcre[i:])
+            if err != nil {
+                return "", err
+            }
+            i += n - 1
+            b.WriteString(out)
+
+        case '(':
+            if !strings.HasPrefix(pcre[i:], "(?") {
+                b.WriteByte('(')
+                continue
+            }
+            rest := pcre[i:]
+            switch {
+            case strings.HasPrefix(rest, "(?:"):
+                b.WriteByte('(')
+                i += 2
+            case strings.HasPrefix(rest, "(?i)") && i == 0:
+                i += 3
+            case strings.HasPrefix(rest, "(?P<") || (strings.HasPrefix(rest, "(?<") &&
+                !strings.HasPrefix(rest, "(?<=") && !strings.HasPrefix(rest, "(?<!")):
+                end := strings.IndexByte(rest, '>')
+                if end < 0 {
+                    return "", fmt.Errorf("unterminated group name")
+                }
+                b.WriteByte('(')
+                i += end
+            case strings.HasPrefix(rest, "(?="), strings.HasPrefix(rest, "(?!"),
+                strings.HasPrefix(rest, "(?<="), strings.HasPrefix(rest, "(?<!"):
+                return "", fmt.Errorf("lookaround %q is not supported by POSIX ERE", groupPrefix(rest))
+            default:
+                return "", fmt.Errorf("group modifier %q is not supported by POSIX ERE", groupPrefix(rest))
+            }
+
+        case '*', '+', '?':
+            if wasQuantifier {
+                if ch == '?' {
+                    continue // lazy quantifier: same truth value as greedy
+                }
+                if ch == '+' {
+                    return "", fmt.Errorf("possessive quantifier is not supported by POSIX ERE")
+                }
+            }
+            b.WriteByte(ch)
+            afterQuantifier = true
+
+        case '{':
+            end := strings.IndexByte(pcre[i:], '}')
+            if end < 0 || !isInterval(pcre[i+1:i+end]) {
+                b.WriteString(`\{`)
+                continue
+            }
+            b.WriteString(pcre[i : i+end+1])
+            i += end
+            afterQuantifier = true
+
+        default:
+            b.WriteByte(ch)
+        }
+    }
+
+    return b.String(), nil
+}
+
+// translateEscape handles the text after a backslash. It returns the ERE
+// replacement and how many bytes of s were consumed.
+func translateEscape(s string, inBracket bool) (string, int, error) {
+    ch := s[0]
+    classes := map[byte][2]string{
+        'd': {"[0-9]", "0-9"},
+        'w': {"[[:alnum:]_]", "[:alnum:]_"},
+        's': {"[[:space:]]", "[:space:]"},
+    }
+    if c, ok := classes[ch]; ok {
+        if inBracket {
+            return c[1], 1, nil
+        }
+        return c[0], 1, nil
+    }
+    if c, ok := classes[ch+('a'-'A')]; ok && ch >= 'A' && ch <= 'Z' {
+        if inBracket {
+            return "", 0, fmt.Errorf(`negated class \%c inside [...] is not supported by POSIX ERE`, ch)
+        }
+        return "[^" + c[1] + "]", 1, nil
+    }
+
+    switch ch {
+    case 'A':
+        return "^", 1, nil
+    case 'z', 'Z':
+        return "$", 1, nil
+    case 'n':
+        return "\n", 1, nil
+    case 't':
+        return "\t", 1, nil
+    case 'r':
+        return "\r", 1, nil
+    case 'x':
+        if len(s) >= 3 {
+            if v, err := strconv.ParseUint(s[1:3], 16, 8); err == nil {
+                return literal(byte(v), inBracket), 3, nil
+            }
+        }
+        return "", 0, fmt.Errorf(`escape \x is only supported as \xHH`)
+    case 'b', 'B':
+        return "", 0, fmt.Errorf(`word boundary \%c is not supported by POSIX ERE`, ch)
+    }
+    if ch >= '1' && ch <= '9' {
+        return "", 0, fmt.Errorf(`backreference \%c is not supported by POSIX ERE`, ch)
+    }
+    if (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9') {
+        return "", 0, fmt.Errorf(`escape \%c is not supported by POSIX ERE`, ch)
+    }
+    return literal(ch, inBracket), 1, nil
+}
+
+// literal renders a single character so ERE matches it literally.
+func literal(ch byte, inBracket bool) string {
+    if inBracket {
+        return string(ch)
+    }
+    if strings.IndexByte(`.[]()*+?{}|^$\`, ch) >= 0 {
+        return `\` + string(ch)
+    }
+    return string(ch)
+}
+
+// translateBracket converts a [...] expression starting at s[0]. ERE has no
+// escapes inside brackets, so escaped ], - and ^ are moved to the positions
+// where they are literal.
+func translateBracket(s string) (string, int, error) {
+    i := 1
+    negate := false
+    if i < len(s) && s[i] == '^' {
+        negate = true
+        i++
+    }
+
+    var body strings.Builder
+    closeBracket, dash, caret := false, false, false
+    first := true
+    for ; i < len(s); i++ {
+        ch := s[i]
+        switch {
+        case ch == ']' && !first:
+            if body.Len() == 0 && caret && !negate && !closeBracket && !dash {
+                return `\^`, i + 1, nil // a lone ^ cannot be written inside [...]
+            }
+            var b strings.Builder
+            b.WriteByte('[')
+            if negate {
+                b.WriteByte('^')
+            }
+            if closeBracket {
+                b.WriteByte(']')
+            }
+            b.WriteString(body.String())
+            if caret {
+                b.WriteByte('^')
+            }
+            if dash {
+                b.WriteByte('-')
+            }
+            b.WriteByte(']')
+            if b.Len() == 2 || (negate && b.Len() == 3) {
+                return "", 0, fmt.Errorf("empty character class")
+            }
+            return b.String(), i + 1, nil
+        case ch == ']' && first:
+            closeBracket = true
+        case ch == '[' && strings.HasPrefix(s[i:], "[:"):
+            end := strings.Index(s[i:], ":]")
+            if end < 0 {
+                return "", 0, fmt.Errorf("unterminated character class")
+            }
+            body.WriteString(s[i : i+end+2])
+            i += end + 1
+        case ch == '\\':
+            if i+1 >= len(s) {
+                return "", 0, fmt.Errorf("unterminated character class")
+            }
+            i++
+            switch s[i] {
+            case ']':
+                closeBracket = true
+            case '-':
+                dash = true
+            case '^':
+                caret = true
+            case '\\':
+                body.WriteByte('\\')
+            default:
+                out, n, err := translateEscape(s[i:], true)
+                if err != nil {
+                    return "", 0, err
+                }
+                // \xHH may spell one of the characters placed above.
+                switch out {
+                case "]":
+                    closeBracket = true
+                case "-":
+                    dash = true
+                case "^":
+                    caret = true
+                default:
+                    body.WriteString(out)
+                }
+                i += n - 1
+            }
+        default:
+            body.WriteByte(ch)
+        }
+        first = false
+    }
+    return "", 0, fmt.Errorf("unterminated character class")
+}
+
+func isInterval(s string) bool {
+    if s == "" {
+        return false
+    }
+    for _, part := range strings.SplitN(s, ",", 2) {
+        for _, r := range part {
+            if r < '0' || r > '9' {
+                return false
+            }
+        }
+    }
+    return s[0] != ','
+}
+
+// groupPrefix returns the "(?x" or "(?<x" opener of a group for messages.
+func groupPrefix(s string) string {
+    if strings.HasPrefix(s, "(?<") && len(s) >= 4 {
+        return s[:4]
+    }
+    if len(s) >= 3 {
+        return s[:3]
+    }
+    return s
+}
@@ -0,0 +1,139 @@
+package sieve
+
+import (
+    "regexp"
+    "strings"
+    "testing"
+)
+
+func TestTranslateRegex(t *testing.T) {
+    tests := []struct {
+        pcre string
+        ere  string
+    }{
+        // classes
+        {`invoice\s+\d+`, `invoice[[:space:]]+[0-9]+`},
+        {`\w+@\w+`, `[[:alnum:]_]+@[[:alnum:]_]+`},
+        {`\D\W\S`, `[^0-9][^[:alnum:]_][^[:space:]]`},
+        {`[\d\s-]+`, `[0-9[:space:]-]+`},
+        {`[^\w.]`, `[^[:alnum:]_.]`},
+        // lazy quantifiers become greedy
+        {`a.*?b`, `a.*b`},
+        {`a+?b??c{2,3}?`, `a+b?c{2,3}`},
+        // groups
+        {`(?:re|fwd):`, `(re|fwd):`},
+        {`(?P<id>\d+)`, `([0-9]+)`},
+        {`(?<id>x)`, `(x)`},
+        {`(?i)urgent`, `urgent`},
+        // anchors and escapes
+        {`\Aabc\z`, `^abc$`},
+        {`\.\*\(x\)`, `\.\*\(x\)`},
+        {`a\x41`, `aA`},
+        {`a\x2e`, `a\.`},
+        {`a{`, `a\{`},
+        // brackets: escaped ] - ^ move to where ERE reads them literally
+        {`[\]a]`, `[]a]`},
+        {`[a\-z]`, `[az-]`},
+        {`[\^a]`, `[a^]`},
+        {`[\^]`, `\^`},
+        {`[\x5da]`, `[]a]`},
+        {`[a\x2dz]`, `[az-]`},
+        {`[\x5e\x41]`, `[A^]`},
+        {`[^\x5d\x2d]`, `[^]-]`},
+        {`[[:digit:]x]`, `[[:digit:]x]`},
+    }
+    for _, tt := range tests {
+        got, err := translateRegex(tt.pcre)
+        if err != nil {
+            t.Errorf("translateRegex(%q): %v", tt.pcre, err)
+            continue
+        }
+        if got != tt.ere {
+            t.Errorf("translateRegex(%q) = %q, want %q", tt.pcre, got, tt.ere)
+        }
+        if _, err := regexp.CompilePOSIX(got); err != nil {
+            t.Errorf("translateRegex(%q) = %q is not a valid ERE: %v", tt.pcre, got, err)
+        }
+    }
+}
+
+func TestTranslateRegexErrors(t *testing.T) {
+    tests := []struct {
+        pcre string
+        err  string // part of the error message
+    }{
+        {`foo(?=bar)`, "lookaround"},
+        {`foo(?!bar)`, "lookaround"},
+        {`(?<=re:)x`, "lookaround"},
+        {`(?<!re:)x`, "lookaround"},
+        {`(a)\1`, "backreference"},
+        {`\bword\b`, "word boundary"},
+        {`a++`, "possessive"},
+        {`a(?s).b`, "group modifier"},
+        {`x(?i)y`, "group modifier"},
+        {`\p{L}`, `escape \p`},
+        {`[\W]`, "negated class"},
+        {`[abc`, "unterminated"},
+        {`abc\`, "trailing backslash"},
+    }
+    for _, tt := range tests {
+        got, err := translateRegex(tt.pcre)
+        if err == nil {
+            t.Errorf("translateRegex(%q) = %q, want an error", tt.pcre, got)
+            continue
+        }
+        if !strings.Contains(err.Error(), tt.err) {
+            t.Errorf("translateRegex(%q): %v, want %q", tt.pcre, err, tt.err)
+        }
+    }
+}
+
+// TestTranslateRegexMatches checks that translated patterns match the same
+// strings as the originals.
+func TestTranslateRegexMatches(t *testing.T) {
+    tests := []struct {
+        pcre  string
+        match []string
+        miss  []string
+    }{
+        {`^\[list\]\s+\d{4}`, []string{"[list] 2024 news"}, []string{"[list]2024", "x [list] 2024"}},
+        {`(?:re|fwd):.*?urgent`, []string{"Re: very urgent", "fwd: urgent"}, []string{"urgent re:"}},
+        {`[\w.]+@example\.com$`, []string{"a.b_c@example.com"}, []string{"a@exampleXcom", "a@example.com.gr"}},
+    }
+    for _, tt := range tests {
+        ere, err := translateRegex(tt.pcre)
+        if err != nil {
+            t.Fatalf("translateRegex(%q): %v", tt.pcre, err)
+        }
+        // Sieve's default comparator is case-insensitive; the patterns
+        // are lower-case.
+        re := regexp.MustCompilePOSIX(ere)
+        for _, s := range tt.match {
+            if !re.MatchString(strings.ToLower(s)) {
+                t.Errorf("%q (ERE %q) does not match %q", tt.pcre, ere, s)
+            }
+        }
+        for _, s := range tt.miss {
+            if re.MatchString(strings.ToLower(s)) {
+                t.Errorf("%q (ERE %q) matches %q", tt.pcre, ere, s)
+            }
+        }
+    }
+}
+
+func TestUntranslatableRegexIsReported(t *testing.T) {
+    f := Filter{Filter: []FilterEntry{{
+        Filtername: "Look",
+        Enabled:    1,
+        Rules:      []Rule{{Part: "$header_subject:", Match: "matches", Val: `foo(?=bar)`}},
+        Actions:    []Action{{Action: "save", Dest: "$home/mail/ex.gr/chris/.Foo"}},
+    }}}
+    scripts, report := ConvertFilters(f, DefaultOptions())
+    if len(scripts) != 1 || !strings.Contains(scripts[0].Content, "if false") {
+        t.Fatalf("script = %v, want a false placeholder", scripts)
+    }
+    if len(report.Items) == 0 || report.Items[0].Kind != ReportBlocking ||
+        !strings.Contains(report.Items[0].Message, "untranslatable") {
+        t.Errorf("report = %v, want a blocking untranslatable item", report.Items)
+    }
+}
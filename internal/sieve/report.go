@@ -0,0 +1,89 @@
+package sieve
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+)
+
+// Report kinds.
+const (
+    // ReportDegraded: a construct was rewritten or dropped because the
+    // target profile lacks the extension it needs.
+    ReportDegraded = "degraded"
+    // ReportBlocking: the script will fail or misbehave on the target until
+    // an admin resolves the item.
+    ReportBlocking = "blocking"
+    // ReportDiscard: matching messages are dropped without delivery.
+    ReportDiscard = "discard"
+    // ReportApprox: the Sieve test is close to, but not exactly, what the
+    // Exim condition checks.
+    ReportApprox = "approximate"
+    // ReportRewrite: a condition was moved to another header by the
+    // [spam_headers] table.
+    ReportRewrite = "rewritten"
+    // ReportRoundcube: valid Sieve that Roundcube's filter editor cannot
+    // show as a rule (Roundcube dialect only).
+    ReportRoundcube = "roundcube"
+    // ReportSOGo: a filter SOGo cannot represent; it stays in the separate
+    // Sieve script next to the SOGo filters.
+    ReportSOGo = "sogo"
+)
+
+// ReportItem is one conversion note that needs an admin's attention.
+type ReportItem struct {
+    Filter    string `json:"filter"`
+    Kind      string `json:"kind"`
+    Extension string `json:"extension,omitempty"`
+    Message   string `json:"message"`
+}
+
+func (it ReportItem) String() string {
+    if it.Extension != "" {
+        return fmt.Sprintf("[%s] %s: %s (extension %q)", it.Kind, it.Filter, it.Message, it.Extension)
+    }
+    return fmt.Sprintf("[%s] %s: %s", it.Kind, it.Filter, it.Message)
+}
+
+// Report collects what ConvertFilters could not translate one-to-one.
+type Report struct {
+    Profile string       `json:"profile"`
+    Items   []ReportItem `json:"items"`
+}
+
+func (r *Report) add(filter, kind, ext, format string, args ...interface{}) {
+    r.Items = append(r.Items, ReportItem{
+        Filter:    filter,
+        Kind:      kind,
+        Extension: ext,
+        Message:   fmt.Sprintf(format, args...),
+    })
+}
+
+// Merge appends the items of another report that r does not hold yet, so
+// a filter converted twice (e.g. for the mailbox script and sogo-extra) is
+// reported once.
+func (r *Report) Merge(other *Report) {
+    if other == nil {
+        return
+    }
+    seen := make(map[ReportItem]bool, len(r.Items))
+    for _, it := range r.Items {
+        seen[it] = true
+    }
+    for _, it := range other.Items {
+        if !seen[it] {
+            seen[it] = true
+            r.Items = append(r.Items, it)
+        }
+    }
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(path string) error {
+    data, err := json.MarshalIndent(r, "", "  ")
+    if err != nil {
+        return err
+    }
+    return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
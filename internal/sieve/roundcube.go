@@ -0,0 +1,278 @@
+package sieve
+
+import (
+    "fmt"
+    "strings"
+)
+
+// Output dialects (Options.Dialect).
+const (
+    DialectPlain     = "plain"     // canonical layout, anything the profile allows
+    DialectRoundcube = "roundcube" // rules Roundcube's filter editor can show and edit
+)
+
+// roundcubeHeader opens scripts written in the Roundcube dialect. Roundcube
+// keeps leading comments as the script prefix and writes them back.
+const roundcubeHeader = "Generated by exim2sieve (Roundcube managesieve rules)"
+
+// roundcubeTests are the tests Roundcube's managesieve plugin turns into
+// rule rows; anything else makes it fall back to the raw script editor.
+var roundcubeTests = map[string]bool{
+    "header": true, "address": true, "envelope": true, "exists": true,
+    "size": true, "body": true, "date": true, "currentdate": true,
+    "string": true, "duplicate": true, "spamtest": true, "virustest": true,
+    "true": true, "false": true,
+}
+
+// roundcubeActions are the actions the plugin offers in a rule.
+var roundcubeActions = map[string]bool{
+    "fileinto": true, "redirect": true, "reject": true, "ereject": true,
+    "discard": true, "keep": true, "stop": true, "vacation": true,
+    "setflag": true, "addflag": true, "removeflag": true, "set": true,
+    "notify": true, "include": true, "return": true,
+    "addheader": true, "deleteheader": true,
+}
+
+// ApplyDialect rewrites a combined script for opts.Dialect and lists in
+// report what the dialect cannot express. The plain dialect returns sc
+// unchanged.
+//
+// In the Roundcube dialect every rule is a single named if whose test is
+// one test, or an allof/anyof of plain tests. A cPanel rule mixing and/or
+// becomes one rule per alternative; as each ends with stop, the first
+// match still wins. Actions outside an if are wrapped in "if true".
+func ApplyDialect(sc SieveScript, opts Options, report *Report) SieveScript {
+    if opts.Dialect != DialectRoundcube {
+        return sc
+    }
+    tree := sc.Script
+    if tree == nil {
+        parsed, err := ParseScript(sc.Content)
+        if err != nil {
+            report.add(sc.Name, ReportRoundcube, "", "script cannot be parsed, left as is: %v", err)
+            return sc
+        }
+        tree = parsed
+    }
+
+    rc := &roundcube{report: report, name: sc.Name, names: map[string]int{}}
+    out := &Script{}
+    var loose []*Command // actions outside any if
+
+    flush := func() {
+        if len(loose) == 0 {
+            return
+        }
+        // The rule header of the first action belongs to the wrapper.
+        first := *loose[0]
+        wrap := &Command{Name: "if", Test: NewTest("true"), Comments: first.Comments}
+        first.Comments = nil
+        wrap.Block = append([]*Command{&first}, loose[1:]...)
+        out.Commands = append(out.Commands, rc.rules(wrap)...)
+        loose = nil
+    }
+
+    for _, cmd := range tree.Commands {
+        switch {
+        case cmd.Name == "require" || cmd.IsComment():
+            flush()
+            out.Commands = append(out.Commands, cmd)
+        case cmd.Name == "if":
+            flush()
+            out.Commands = append(out.Commands, rc.rules(cmd)...)
+        case cmd.Name == "elsif" || cmd.Name == "else":
+            flush()
+            rc.report.add(rc.name, ReportRoundcube, "", "%s branches cannot be shown as a rule", cmd.Name)
+            out.Commands = append(out.Commands, cmd)
+        default:
+            loose = append(loose, cmd)
+        }
+    }
+    flush()
+
+    if len(out.Commands) > 0 {
+        first := *out.Commands[0]
+        first.Comments = append([]string{roundcubeHeader}, withoutLine(first.Comments, roundcubeHeader)...)
+        out.Commands[0] = &first
+    }
+    return NewSieveScript(sc.Name, out)
+}
+
+type roundcube struct {
+    report *Report
+    name   string         // current rule name
+    carry  string         // name taken off a variables prelude
+    names  map[string]int // rules emitted per name, for numbering
+}
+
+// rules checks one top-level if and returns it as Roundcube rules.
+func (rc *roundcube) rules(cmd *Command) []*Command {
+    cmd = rc.named(cmd)
+    rc.block(cmd.Block)
+
+    alts := rc.alternatives(cmd.Test)
+    if len(alts) == 1 {
+        if alts[0] != cmd.Test {
+            c := *cmd
+            c.Test = alts[0]
+            return []*Command{&c}
+        }
+        return []*Command{cmd}
+    }
+
+    out := make([]*Command, 0, len(alts))
+    for i, t := range alts {
+        c := *cmd
+        c.Test = t
+        c.Block = append([]*Command{}, cmd.Block...)
+        if i > 0 {
+            c.Comments = []string{fmt.Sprintf("rule:[%s]", rc.next())}
+        }
+        out = append(out, &c)
+    }
+    return out
+}
+
+// named makes sure the if starts with a "# rule:[...]" header. Variable
+// preludes hand their name on to the rule that follows them.
+func (rc *roundcube) named(cmd *Command) *Command {
+    c := *cmd
+    if n := ruleName(c.Comments); n != "" {
+        rc.name = n
+        rc.names[n] = 1
+        if _, ok := setPreludeKey(cmd); ok {
+            rc.carry = n
+            c.Comments = replaceRuleName(c.Comments, n+" (variables)")
+        }
+        return &c
+    }
+
+    name := rc.carry
+    rc.carry = ""
+    if name == "" {
+        name = rc.next()
+    }
+    c.Comments = append([]string{fmt.Sprintf("rule:[%s]", name)}, c.Comments...)
+    return &c
+}
+
+// next numbers another rule under the current name.
+func (rc *roundcube) next() string {
+    rc.names[rc.name]++
+    return fmt.Sprintf("%s (%d)", rc.name, rc.names[rc.name])
+}
+
+// alternatives returns the tests of the rules a test becomes: itself when
+// Roundcube can show it, or the branches of an anyof over allof groups.
+func (rc *roundcube) alternatives(t *Test) []*Test {
+    if rc.flat(t) {
+        rc.simple(t)
+        return []*Test{t}
+    }
+    if t.Name == "anyof" {
+        ok := true
+        for _, sub := range t.Tests {
+            ok = ok && rc.flat(sub)
+        }
+        if ok {
+            rc.simple(t)
+            return t.Tests
+        }
+    }
+    rc.report.add(rc.name, ReportRoundcube, "", "test is nested deeper than one allof/anyof: %s", t.OneLine())
+    return []*Test{t}
+}
+
+// flat reports whether t is a plain test or one allof/anyof of plain tests.
+func (rc *roundcube) flat(t *Test) bool {
+    if t.Name != "allof" && t.Name != "anyof" {
+        return plainTest(t)
+    }
+    for _, sub := range t.Tests {
+        if !plainTest(sub) {
+            return false
+        }
+    }
+    return true
+}
+
+// plainTest is a single (possibly negated) test.
+func plainTest(t *Test) bool {
+    if t.Name == "not" && len(t.Tests) == 1 {
+        t = t.Tests[0]
+    }
+    return t.Name != "allof" && t.Name != "anyof" && t.Name != "not"
+}
+
+// simple reports the plain tests of t that Roundcube has no row for.
+func (rc *roundcube) simple(t *Test) {
+    if len(t.Tests) > 0 {
+        for _, sub := range t.Tests {
+            rc.simple(sub)
+        }
+        return
+    }
+    switch {
+    case !roundcubeTests[t.Name]:
+        rc.report.add(rc.name, ReportRoundcube, "", "test %q is not supported by the Roundcube editor", t.Name)
+    case strings.Contains(t.Comment, "TODO") && t.Name == "true":
+        rc.report.add(rc.name, ReportRoundcube, "", "placeholder %q shows as an \"all messages\" rule", t.OneLine())
+    case strings.Contains(t.Comment, "TODO"):
+        rc.report.add(rc.name, ReportRoundcube, "", "placeholder %q shows as a disabled rule", t.OneLine())
+    }
+}
+
+// block reports actions of a rule that Roundcube cannot show.
+func (rc *roundcube) block(cmds []*Command) {
+    for _, c := range cmds {
+        switch {
+        case c.IsComment():
+        case c.HasBlock():
+            rc.report.add(rc.name, ReportRoundcube, "", "nested %s inside a rule", c.Name)
+        case !roundcubeActions[c.Name]:
+            rc.report.add(rc.name, ReportRoundcube, "", "action %q is not supported by the Roundcube editor", c.Name)
+        case c.Name == "vacation" && hasTag(c.Args, "mime"):
+            rc.report.add(rc.name, ReportRoundcube, "", "vacation :mime body is shown with its MIME headers in the editor")
+        }
+    }
+}
+
+func hasTag(args []Arg, tag string) bool {
+    for _, a := range args {
+        if t, ok := a.(Tag); ok && string(t) == tag {
+            return true
+        }
+    }
+    return false
+}
+
+// ruleName returns the name of a "rule:[name]" comment, if any.
+func ruleName(comments []string) string {
+    for _, c := range comments {
+        if strings.HasPrefix(c, "rule:[") && strings.HasSuffix(c, "]") {
+            return c[len("rule:[") : len(c)-1]
+        }
+    }
+    return ""
+}
+
+func replaceRuleName(comments []string, name string) []string {
+    out := make([]string, 0, len(comments))
+    for _, c := range comments {
+        if strings.HasPrefix(c, "rule:[") {
+            c = fmt.Sprintf("rule:[%s]", name)
+        }
+        out = append(out, c)
+    }
+    return out
+}
+
+func withoutLine(lines []string, drop string) []string {
+    var out []string
+    for _, l := range lines {
+        if l != drop {
+            out = append(out, l)
+        }
+    }
+    return out
+}
@@ -0,0 +1,577 @@
+package sieve
+
+import (
+    "fmt"
+    "math/big"
+    "net/textproto"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// SimAction is one action the simulated script would take.
+type SimAction struct {
+    Action string   `json:"action"`
+    Tags   []string `json:"tags,omitempty"` // e.g. "copy", "create"
+    Args   []string `json:"args,omitempty"`
+    Line   int      `json:"line,omitempty"`
+}
+
+func (a SimAction) String() string {
+    var parts []string
+    parts = append(parts, a.Action)
+    for _, t := range a.Tags {
+        parts = append(parts, ":"+t)
+    }
+    for _, s := range a.Args {
+        parts = append(parts, quoteString(s))
+    }
+    return strings.Join(parts, " ")
+}
+
+// SimResult is the outcome of running a script against one message.
+type SimResult struct {
+    Message      string      `json:"message"`
+    Actions      []SimAction `json:"actions"`
+    ImplicitKeep bool        `json:"implicit_keep"`
+    Notes        []string    `json:"notes,omitempty"`
+}
+
+// Simulate evaluates a script against a message the way a Sieve interpreter
+// would, without delivering anything. It supports the tests and actions the
+// converter emits (header/address/envelope/body/size/exists, :is/:contains/
+// :matches/:regex/:value/:count, currentdate, fileinto/redirect/reject/ereject/discard/
+// keep/stop/vacation/pipe) and reports anything else in Notes.
+func Simulate(s *Script, msg *Message) SimResult {
+    sim := &simulator{msg: msg, keep: true, vars: map[string]string{}}
+    sim.commands(s.Commands)
+    return SimResult{
+        Message:      msg.Name,
+        Actions:      sim.actions,
+        ImplicitKeep: sim.keep,
+        Notes:        sim.notes,
+    }
+}
+
+type simulator struct {
+    msg     *Message
+    vars    map[string]string // variables extension: set "name" "value"
+    groups  []string          // ${0}..${9} of the last successful :matches
+    keep    bool // implicit keep still in effect
+    stopped bool
+    actions []SimAction
+    notes   []string
+}
+
+func (s *simulator) note(pos Pos, format string, args ...interface{}) {
+    msg := fmt.Sprintf(format, args...)
+    if pos.Line > 0 {
+        msg = fmt.Sprintf("line %d: %s", pos.Line, msg)
+    }
+    s.notes = append(s.notes, msg)
+}
+
+func (s *simulator) commands(cmds []*Command) {
+    branchTaken := false // an earlier branch of the current if/elsif/else ran
+    for _, c := range cmds {
+        if s.stopped {
+            return
+        }
+        switch c.Name {
+        case "":
+            continue
+        case "if":
+            branchTaken = s.test(c.Test)
+            if branchTaken {
+                s.commands(c.Block)
+            }
+        case "elsif":
+            if !branchTaken && s.test(c.Test) {
+                branchTaken = true
+                s.commands(c.Block)
+            }
+        case "else":
+            if !branchTaken {
+                s.commands(c.Block)
+            }
+            branchTaken = true
+        default:
+            s.command(c)
+        }
+    }
+}
+
+func (s *simulator) command(c *Command) {
+    a := splitArgs(c.Args)
+    add := func(cancelKeep bool) {
+        args := a.strings()
+        for i := range args {
+            args[i] = s.expand(args[i])
+        }
+        s.actions = append(s.actions, SimAction{
+            Action: c.Name,
+            Tags:   a.flags(),
+            Args:   args,
+            Line:   c.Pos.Line,
+        })
+        if cancelKeep && !a.has("copy") {
+            s.keep = false
+        }
+    }
+
+    switch c.Name {
+    case "require":
+    case "set":
+        if args := a.strings(); len(args) == 2 {
+            s.vars[strings.ToLower(args[0])] = s.expand(args[1])
+        }
+    case "stop":
+        s.stopped = true
+    case "keep":
+        add(true)
+    case "discard", "reject", "ereject":
+        add(true)
+    case "fileinto", "redirect", "pipe":
+        add(true)
+    case "vacation", "addflag", "setflag", "removeflag", "addheader", "deleteheader", "notify":
+        add(false)
+    default:
+        s.note(c.Pos, "command %q is not simulated", c.Name)
+    }
+}
+
+func (s *simulator) test(t *Test) bool {
+    if strings.Contains(t.Comment, "TODO") {
+        s.note(t.Pos, "placeholder test %s /* %s */", t.Name, t.Comment)
+    }
+    a := splitArgs(t.Args)
+
+    switch t.Name {
+    case "true":
+        return true
+    case "false":
+        return false
+    case "not":
+        if len(t.Tests) != 1 {
+            s.note(t.Pos, "not expects exactly one test")
+            return false
+        }
+        return !s.test(t.Tests[0])
+    case "allof":
+        for _, sub := range t.Tests {
+            if !s.test(sub) {
+                return false
+            }
+        }
+        return true
+    case "anyof":
+        for _, sub := range t.Tests {
+            if s.test(sub) {
+                return true
+            }
+        }
+        return false
+    case "exists":
+        for _, h := range a.list(0) {
+            if len(s.msg.Header[textproto.CanonicalMIMEHeaderKey(h)]) == 0 {
+                return false
+            }
+        }
+        return true
+    case "size":
+        if len(a.pos) == 0 {
+            return false
+        }
+        n, ok := a.pos[0].(Number)
+        if !ok {
+            return false
+        }
+        limit := numberValue(n)
+        if a.has("over") {
+            return uint64(s.msg.Size) > limit
+        }
+        return uint64(s.msg.Size) < limit
+    case "header":
+        var values []string
+        for _, h := range a.list(0) {
+            values = append(values, s.msg.headerValues(h)...)
+        }
+        return s.match(t, values, a.list(1), a)
+    case "address":
+        var values []string
+        for _, h := range a.list(0) {
+            for _, addr := range s.msg.addressValues(h) {
+                values = append(values, addressPart(addr, a))
+            }
+        }
+        return s.match(t, values, a.list(1), a)
+    case "envelope":
+        var values []string
+        for _, part := range a.list(0) {
+            var addr string
+            switch strings.ToLower(part) {
+            case "from":
+                addr = s.msg.EnvelopeFrom
+            case "to":
+                addr = s.msg.EnvelopeTo
+            default:
+                s.note(t.Pos, "envelope part %q is not simulated", part)
+                continue
+            }
+            values = append(values, addressPart(addr, a))
+        }
+        return s.match(t, values, a.list(1), a)
+    case "body":
+        return s.match(t, []string{s.msg.bodyText()}, a.list(0), a)
+    case "string":
+        return s.match(t, a.list(0), a.list(1), a)
+    case "currentdate":
+        now := time.Now()
+        if zone, ok := a.str("zone"); ok {
+            now = now.In(fixedZone(zone))
+        }
+        parts := a.list(0)
+        if len(parts) == 0 {
+            return false
+        }
+        v, ok := datePart(now, parts[0])
+        if !ok {
+            s.note(t.Pos, "date part %q is not simulated", parts[0])
+            return false
+        }
+        return s.match(t, []string{v}, a.list(1), a)
+    }
+
+    s.note(t.Pos, "test %q is not simulated, assuming false", t.Name)
+    return false
+}
+
+// match applies the match type, comparator and relational operator of a
+// test to the extracted values and the key list.
+func (s *simulator) match(t *Test, values, keys []string, a simArgs) bool {
+    cmp := "i;ascii-casemap"
+    if c, ok := a.str("comparator"); ok {
+        cmp = c
+    }
+
+    if rel, ok := a.str("count"); ok {
+        count := fmt.Sprintf("%d", len(values))
+        for _, k := range keys {
+            if relation(compareValues(count, k, "i;ascii-numeric"), rel) {
+                return true
+            }
+        }
+        return false
+    }
+
+    for _, v := range values {
+        for _, k := range keys {
+            k = s.expand(k)
+            if a.has("matches") {
+                groups, err := matchGlob(v, k, cmp == "i;ascii-casemap")
+                if err != nil {
+                    s.note(t.Pos, "%v", err)
+                    continue
+                }
+                if groups != nil {
+                    s.groups = groups
+                    return true
+                }
+                continue
+            }
+            ok, err := matchOne(v, k, cmp, a)
+            if err != nil {
+                s.note(t.Pos, "%v", err)
+                continue
+            }
+            if ok {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// expand substitutes ${name} and ${N} variables (RFC 5229) in s.
+func (s *simulator) expand(str string) string {
+    if !strings.Contains(str, "${") {
+        return str
+    }
+    return varRef.ReplaceAllStringFunc(str, func(ref string) string {
+        name := strings.ToLower(ref[2 : len(ref)-1])
+        if n, err := strconv.Atoi(name); err == nil {
+            if n < len(s.groups) {
+                return s.groups[n]
+            }
+            return ""
+        }
+        return s.vars[name]
+    })
+}
+
+var varRef = regexp.MustCompile(`\$\{[A-Za-z0-9_.]+\}`)
+
+// matchGlob applies a :matches pattern and returns the match variables
+// (whole value, then one per wildcard), or nil if it does not match.
+func matchGlob(value, key string, fold bool) ([]string, error) {
+    re, err := regexp.Compile(globToRegexp(key, fold))
+    if err != nil {
+        return nil, err
+    }
+    return re.FindStringSubmatch(value), nil
+}
+
+func matchOne(value, key, cmp string, a simArgs) (bool, error) {
+    fold := cmp == "i;ascii-casemap"
+
+    switch {
+    case a.has("contains"):
+        if fold {
+            return strings.Contains(strings.ToLower(value), strings.ToLower(key)), nil
+        }
+        return strings.Contains(value, key), nil
+    case a.has("regex"):
+        expr := key
+        if fold {
+            expr = "(?i)" + expr
+        }
+        re, err := regexp.Compile(expr)
+        if err != nil {
+            return false, fmt.Errorf("invalid :regex %q: %v", key, err)
+        }
+        return re.MatchString(value), nil
+    }
+
+    if rel, ok := a.str("value"); ok {
+        return relation(compareValues(value, key, cmp), rel), nil
+    }
+    return compareValues(value, key, cmp) == 0, nil
+}
+
+// compareValues orders two strings under a comparator (RFC 4790).
+func compareValues(x, y, cmp string) int {
+    switch cmp {
+    case "i;ascii-numeric":
+        return compareNumeric(x, y)
+    case "i;octet":
+        return strings.Compare(x, y)
+    }
+    return strings.Compare(strings.ToUpper(x), strings.ToUpper(y))
+}
+
+// compareNumeric implements i;ascii-numeric: the leading digits are the
+// value; strings that do not start with a digit count as positive infinity.
+func compareNumeric(x, y string) int {
+    xn, xok := leadingNumber(x)
+    yn, yok := leadingNumber(y)
+    switch {
+    case !xok && !yok:
+        return 0
+    case !xok:
+        return 1
+    case !yok:
+        return -1
+    }
+    return xn.Cmp(yn)
+}
+
+func leadingNumber(s string) (*big.Int, bool) {
+    end := 0
+    for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+        end++
+    }
+    if end == 0 {
+        return nil, false
+    }
+    n, _ := new(big.Int).SetString(s[:end], 10)
+    return n, true
+}
+
+func relation(c int, rel string) bool {
+    switch strings.ToLower(rel) {
+    case "gt":
+        return c > 0
+    case "ge":
+        return c >= 0
+    case "lt":
+        return c < 0
+    case "le":
+        return c <= 0
+    case "eq":
+        return c == 0
+    case "ne":
+        return c != 0
+    }
+    return false
+}
+
+// globToRegexp translates a Sieve :matches pattern (* and ?, with backslash
+// escapes) into an anchored Go regexp. Each wildcard is a group; "*" is
+// non-greedy as RFC 5229 requires for match variables.
+func globToRegexp(glob string, fold bool) string {
+    var b strings.Builder
+    b.WriteString("^(?s)")
+    if fold {
+        b.WriteString("(?i)")
+    }
+    for i := 0; i < len(glob); i++ {
+        switch ch := glob[i]; ch {
+        case '*':
+            b.WriteString("(.*?)")
+        case '?':
+            b.WriteString("(.)")
+        case '\\':
+            if i+1 < len(glob) {
+                i++
+                b.WriteString(regexp.QuoteMeta(string(glob[i])))
+            }
+        default:
+            b.WriteString(regexp.QuoteMeta(string(ch)))
+        }
+    }
+    b.WriteString("$")
+    return b.String()
+}
+
+// datePart extracts a date-part (RFC 5260 §4.2) from t.
+func datePart(t time.Time, part string) (string, bool) {
+    layouts := map[string]string{
+        "year": "2006", "month": "01", "day": "02", "date": "2006-01-02",
+        "hour": "15", "minute": "04", "second": "05", "time": "15:04:05",
+        "iso8601": "2006-01-02T15:04:05-07:00", "std11": "Mon, 02 Jan 2006 15:04:05 -0700",
+        "zone": "-0700",
+    }
+    if l, ok := layouts[strings.ToLower(part)]; ok {
+        return t.Format(l), true
+    }
+    if strings.ToLower(part) == "weekday" {
+        return fmt.Sprintf("%d", int(t.Weekday())), true
+    }
+    return "", false
+}
+
+// fixedZone parses a :zone argument like "+0200".
+func fixedZone(zone string) *time.Location {
+    if len(zone) != 5 || (zone[0] != '+' && zone[0] != '-') {
+        return time.UTC
+    }
+    h, err1 := strconv.Atoi(zone[1:3])
+    m, err2 := strconv.Atoi(zone[3:5])
+    if err1 != nil || err2 != nil {
+        return time.UTC
+    }
+    offset := (h*60 + m) * 60
+    if zone[0] == '-' {
+        offset = -offset
+    }
+    return time.FixedZone(zone, offset)
+}
+
+func addressPart(addr string, a simArgs) string {
+    at := strings.LastIndex(addr, "@")
+    switch {
+    case a.has("localpart"):
+        if at < 0 {
+            return addr
+        }
+        return addr[:at]
+    case a.has("domain"):
+        if at < 0 {
+            return ""
+        }
+        return addr[at+1:]
+    }
+    return addr
+}
+
+func numberValue(n Number) uint64 {
+    switch n.Quantifier {
+    case "K":
+        return n.Value << 10
+    case "M":
+        return n.Value << 20
+    case "G":
+        return n.Value << 30
+    }
+    return n.Value
+}
+
+// simArgs splits the arguments of a command or test into tags (with their
+// parameter, if the tag takes one) and positional arguments.
+type simArgs struct {
+    tags map[string]Arg
+    pos  []Arg
+}
+
+// tagsWithParam lists tagged arguments that consume the next argument.
+var tagsWithParam = map[string]bool{
+    "comparator": true, "value": true, "count": true, "days": true,
+    "seconds": true, "subject": true, "from": true, "addresses": true,
+    "handle": true, "flags": true, "zone": true, "index": true,
+    "message": true, "importance": true, "options": true,
+}
+
+func splitArgs(args []Arg) simArgs {
+    a := simArgs{tags: map[string]Arg{}}
+    for i := 0; i < len(args); i++ {
+        tag, ok := args[i].(Tag)
+        if !ok {
+            a.pos = append(a.pos, args[i])
+            continue
+        }
+        var param Arg
+        if tagsWithParam[string(tag)] && i+1 < len(args) {
+            i++
+            param = args[i]
+        }
+        a.tags[string(tag)] = param
+    }
+    return a
+}
+
+func (a simArgs) has(tag string) bool {
+    _, ok := a.tags[tag]
+    return ok
+}
+
+func (a simArgs) str(tag string) (string, bool) {
+    p, ok := a.tags[tag]
+    if !ok || p == nil {
+        return "", false
+    }
+    list := ArgStrings(p)
+    if len(list) == 0 {
+        return "", false
+    }
+    return list[0], true
+}
+
+func (a simArgs) list(i int) []string {
+    if i >= len(a.pos) {
+        return nil
+    }
+    return ArgStrings(a.pos[i])
+}
+
+// flags returns the tags that take no parameter, in a stable order.
+func (a simArgs) flags() []string {
+    var out []string
+    for tag, param := range a.tags {
+        if param == nil {
+            out = append(out, tag)
+        }
+    }
+    sort.Strings(out)
+    return out
+}
+
+// strings returns the positional string arguments, flattened.
+func (a simArgs) strings() []string {
+    var out []string
+    for _, p := range a.pos {
+        out = append(out, ArgStrings(p)...)
+    }
+    return out
+}
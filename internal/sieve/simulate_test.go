@@ -0,0 +1,102 @@
+package sieve
+
+import (
+    "net/mail"
+    "strings"
+    "testing"
+)
+
+func testMessage() *Message {
+    return &Message{
+        Name: "test.eml",
+        Header: mail.Header{
+            "From":         {`"The Boss" <boss@ex.gr>`},
+            "To":           {"chris@ex.gr, anna@ex.gr"},
+            "Cc":           {"sales@ex.gr"},
+            "Subject":      {"[list] Invoice 2024-17 =?utf-8?q?caf=C3=A9?="},
+            "X-Spam-Score": {"7.3"},
+        },
+        Body:         []byte("Hello\r\n"),
+        Size:         2048,
+        EnvelopeFrom: "bounce@lists.ex.gr",
+        EnvelopeTo:   "chris@ex.gr",
+    }
+}
+
+// TestSimulateMatchTypes runs one test per script against testMessage and
+// checks whether the rule fired.
+func TestSimulateMatchTypes(t *testing.T) {
+    tests := []struct {
+        name string
+        test string
+        want bool
+    }{
+        {"is", `header :is "Subject" "[list] Invoice 2024-17 café"`, true},
+        {"is case-insensitive", `header :is "Subject" "[LIST] INVOICE 2024-17 café"`, true},
+        {"is octet", `header :is :comparator "i;octet" "Subject" "[list] invoice 2024-17 café"`, false},
+        {"contains", `header :contains "Subject" "invoice"`, true},
+        {"contains miss", `header :contains "Subject" "receipt"`, false},
+        {"matches star", `header :matches "Subject" "[list]*"`, true},
+        {"matches question mark", `header :matches "Subject" "*2024-1?*"`, true},
+        {"matches anchored", `header :matches "Subject" "Invoice*"`, false},
+        {"regex", `header :regex "Subject" "[0-9]{4}-[0-9]+"`, true},
+        {"regex miss", `header :regex "Subject" "^Invoice"`, false},
+        {"address all", `address :is "From" "boss@ex.gr"`, true},
+        {"address localpart", `address :localpart :is "From" "boss"`, true},
+        {"address domain list", `address :domain :is ["To", "Cc"] "ex.gr"`, true},
+        {"envelope from", `envelope :domain :is "from" "lists.ex.gr"`, true},
+        {"envelope to", `envelope :localpart :is "to" "anna"`, false},
+        {"value gt", `header :value "gt" :comparator "i;ascii-numeric" "X-Spam-Score" "5"`, true},
+        {"value lt", `header :value "lt" :comparator "i;ascii-numeric" "X-Spam-Score" "7"`, false},
+        {"value ge whole part", `header :value "ge" :comparator "i;ascii-numeric" "X-Spam-Score" "7"`, true},
+        {"count", `address :count "eq" :comparator "i;ascii-numeric" ["To", "Cc"] "3"`, true},
+        {"count gt", `address :count "gt" :comparator "i;ascii-numeric" "To" "2"`, false},
+        {"size over", `size :over 1K`, true},
+        {"size under", `size :under 2K`, false},
+        {"exists", `exists ["From", "Cc"]`, true},
+        {"not exists", `not exists "Reply-To"`, true},
+        {"anyof", `anyof (false, header :contains "Subject" "list")`, true},
+        {"allof", `allof (true, header :contains "Subject" "nope")`, false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            src := `require ["envelope", "regex", "relational", "comparator-i;ascii-numeric"];
+if ` + tt.test + ` {
+    fileinto "Hit";
+    stop;
+}
+`
+            s, err := ParseScript(src)
+            if err != nil {
+                t.Fatalf("parse: %v", err)
+            }
+            res := Simulate(s, testMessage())
+            hit := len(res.Actions) == 1 && res.Actions[0].Action == "fileinto"
+            if hit != tt.want {
+                t.Errorf("%s: fired = %v, want %v (actions %v, notes %v)", tt.test, hit, tt.want, res.Actions, res.Notes)
+            }
+            if hit == res.ImplicitKeep {
+                t.Errorf("implicit keep = %v after fileinto = %v", res.ImplicitKeep, hit)
+            }
+        })
+    }
+}
+
+func TestSimulateMatchesVariables(t *testing.T) {
+    src := `require ["variables", "envelope", "fileinto"];
+if envelope :matches "to" "*@*" {
+    set "local_part" "${1}";
+}
+if header :matches "Subject" "[*] *" {
+    fileinto "${local_part}/${1}";
+}
+`
+    s, err := ParseScript(src)
+    if err != nil {
+        t.Fatal(err)
+    }
+    res := Simulate(s, testMessage())
+    if len(res.Actions) != 1 || strings.Join(res.Actions[0].Args, "") != "chris/list" {
+        t.Errorf("actions = %v, want fileinto \"chris/list\"", res.Actions)
+    }
+}
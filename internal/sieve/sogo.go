@@ -0,0 +1,291 @@
+package sieve
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "strings"
+)
+
+// SOGo keeps a user's filters in the SOGoSieveFilters user default and
+// regenerates the active Sieve script from them whenever the user saves
+// in its UI, replacing whatever script was active before.
+
+// SOGoFilter is one entry of SOGoSieveFilters.
+type SOGoFilter struct {
+    Name    string       `json:"name"`
+    Active  int          `json:"active"`
+    Match   string       `json:"match"` // all, any or allmessages
+    Rules   []SOGoRule   `json:"rules,omitempty"`
+    Actions []SOGoAction `json:"actions"`
+}
+
+// SOGoRule is one condition row of a SOGo filter.
+type SOGoRule struct {
+    Field        string `json:"field"` // subject, from, to, cc, to_or_cc, size, header, body
+    CustomHeader string `json:"custom_header,omitempty"`
+    Operator     string `json:"operator"`
+    Value        string `json:"value"`
+}
+
+// SOGoAction is one action row of a SOGo filter.
+type SOGoAction struct {
+    Method   string `json:"method"`
+    Argument string `json:"argument,omitempty"`
+}
+
+// ConvertSOGo converts the filters SOGo can represent into SOGoSieveFilters
+// entries. The others are returned in rest, to be converted to Sieve as
+// usual, and listed in the report with kind ReportSOGo.
+//
+// cPanel rules mixing and/or become one SOGo filter per alternative; every
+// filter ends with stop, so the first match still wins. The separate script
+// runs after the SOGo filters, so from the first filter SOGo cannot hold on
+// every filter goes to rest, keeping the order of the original.
+func ConvertSOGo(f Filter, opts Options) (filters []SOGoFilter, rest Filter, report *Report) {
+    if opts.Profile.Extensions == nil {
+        opts.Profile = DefaultOptions().Profile
+    }
+    report = &Report{Profile: opts.Profile.Name}
+    rest.Version = f.Version
+
+    first := ""
+    for _, flt := range f.Filter {
+        if first != "" {
+            report.add(flt.Filtername, ReportSOGo, "", "kept in the separate Sieve script to stay after %q", first)
+            rest.Filter = append(rest.Filter, flt)
+            continue
+        }
+        converted, err := sogoFilters(flt, opts, report)
+        if err != nil {
+            report.add(flt.Filtername, ReportSOGo, "", "kept in the separate Sieve script: %v", err)
+            rest.Filter = append(rest.Filter, flt)
+            first = flt.Filtername
+            continue
+        }
+        filters = append(filters, converted...)
+    }
+    return filters, rest, report
+}
+
+// NoteSOGoVacation reports that an autoresponder kept in the separate
+// script no longer answers messages a SOGo filter matched: that script
+// runs after the SOGo filters, and each of them stops.
+func NoteSOGoVacation(report *Report, name string) {
+    report.add(name, ReportSOGo, "vacation",
+        "runs from the separate Sieve script after the SOGo filters; messages a SOGo filter matches get no reply "+
+            "(set the reply up in SOGo's vacation settings to answer every message)")
+}
+
+// sogoFilters converts one filter. Rewrites of spam headers are added to
+// report only when the whole filter converts; otherwise the Sieve
+// conversion of rest reports them.
+func sogoFilters(flt FilterEntry, opts Options, report *Report) ([]SOGoFilter, error) {
+    if len(flt.Rules) == 0 {
+        return nil, fmt.Errorf("filter has no rules")
+    }
+    actions, err := sogoActions(flt.Actions, opts)
+    if err != nil {
+        return nil, err
+    }
+
+    // An or of single rules is one "any" filter; an or over and-groups
+    // becomes one "all" filter per group.
+    expr := RuleExpr(flt.Rules)
+    groups := []*Expr{expr}
+    match := "all"
+    if expr.Op == ExprOr {
+        match = "any"
+        for _, t := range expr.Terms {
+            if t.Op != ExprRule {
+                groups, match = expr.Terms, "all"
+                break
+            }
+        }
+    }
+
+    rewrites := &Report{}
+    var out []SOGoFilter
+    for i, g := range groups {
+        leaves := []*Expr{g}
+        if g.Op != ExprRule {
+            leaves = g.Terms
+        }
+        var rules []SOGoRule
+        for _, leaf := range leaves {
+            r, err := sogoRule(leaf.Rule, opts, rewrites, flt.Filtername)
+            if err != nil {
+                return nil, err
+            }
+            rules = append(rules, r)
+        }
+
+        name := flt.Filtername
+        if len(groups) > 1 {
+            name = fmt.Sprintf("%s (%d)", flt.Filtername, i+1)
+        }
+        active := 1
+        if flt.Enabled == 0 {
+            active = 0
+        }
+        out = append(out, SOGoFilter{
+            Name:    name,
+            Active:  active,
+            Match:   match,
+            Rules:   rules,
+            Actions: actions,
+        })
+    }
+    report.Merge(rewrites)
+    return out, nil
+}
+
+// sogoRule maps one cPanel rule onto SOGo's fields and operators. A spam
+// header rewrite is noted in report as the Sieve conversion does.
+func sogoRule(r *Rule, opts Options, report *Report, filter string) (SOGoRule, error) {
+    match := strings.ToLower(strings.TrimSpace(r.Match))
+    if hasEximVars(r.Val) {
+        return SOGoRule{}, fmt.Errorf("value %q uses Exim variables", r.Val)
+    }
+    if r.CaseSensitive {
+        return SOGoRule{}, fmt.Errorf("%s %q is case-sensitive", r.Match, r.Val)
+    }
+
+    var rule SOGoRule
+    // SOGo has no envelope field; "any recipient" stays To or Cc.
+    headers := opts
+    headers.AnyRecipient = RecipientHeaders
+    field, err := mapPart(r.Part, headers)
+    if w, ok := spamRewrite(field, opts); ok && err == nil {
+        // Numeric thresholds are not converted for SOGo anyway.
+        report.add(filter, ReportRewrite, "", "%s: %s is tested on %s", ruleText(r), field.headers[0], w.Header)
+        field.headers = []string{w.Header}
+    }
+    switch {
+    case err != nil:
+        return SOGoRule{}, err
+    case field.kind == fieldEnvelope || field.kind == fieldReplyAddress || field.kind == fieldSize ||
+        field.addressPart != "":
+        return SOGoRule{}, fmt.Errorf("%s cannot be tested in SOGo", r.Part)
+    case field.kind == fieldBody:
+        if !opts.Profile.Has("body") {
+            return SOGoRule{}, fmt.Errorf("body rule needs the body extension")
+        }
+        rule.Field = "body"
+    case strings.Join(field.headers, ",") == "To,Cc,Bcc":
+        // "any recipient": SOGo has To or Cc; Bcc is rarely present on delivery.
+        rule.Field = "to_or_cc"
+    case len(field.headers) > 1:
+        return SOGoRule{}, fmt.Errorf("%s cannot be tested in SOGo", r.Part)
+    default:
+        switch h := strings.ToLower(field.headers[0]); h {
+        case "from", "to", "cc", "subject":
+            rule.Field = h
+        default:
+            rule.Field = "header"
+            rule.CustomHeader = field.headers[0]
+        }
+    }
+
+    switch match {
+    case "matches", "matches_regex", "does not match":
+        rule.Operator = "matches"
+        if glob, ok := simpleRegexToGlob(r.Val); ok {
+            rule.Value = glob
+        } else {
+            ere, err := translateRegex(r.Val)
+            if err != nil || !opts.Profile.Has("regex") {
+                return SOGoRule{}, fmt.Errorf("regex %q cannot be used", r.Val)
+            }
+            rule.Operator = "regex"
+            rule.Value = ere
+        }
+        if match == "does not match" {
+            rule.Operator += "_not"
+        }
+        return rule, nil
+    }
+
+    op, negative, pattern := mapMatch(match, r.Val)
+    if op == "" {
+        return SOGoRule{}, fmt.Errorf("unsupported match %q on %s", r.Match, r.Part)
+    }
+    rule.Operator = op
+    rule.Value = pattern
+    if negative {
+        rule.Operator += "_not"
+    }
+    return rule, nil
+}
+
+// sogoActions maps the actions of a filter; SOGo has no pipe, ereject or
+// expansion of Exim variables.
+func sogoActions(actions []Action, opts Options) ([]SOGoAction, error) {
+    var out []SOGoAction
+    keep := false
+    for _, a := range actions {
+        action := strings.ToLower(strings.TrimSpace(a.Action))
+        dest := a.Dest
+
+        switch action {
+        case "discard":
+            out = append(out, SOGoAction{Method: "discard"})
+        case "save":
+            if isDiscardDest(dest) {
+                out = append(out, SOGoAction{Method: "discard"})
+                continue
+            }
+            out = append(out, SOGoAction{Method: "fileinto", Argument: mailboxFromDest(dest, opts)})
+        case "deliver":
+            if !isAddress(dest) || hasEximVars(dest) {
+                return nil, fmt.Errorf("deliver %q is not a plain address", dest)
+            }
+            out = append(out, SOGoAction{Method: "redirect", Argument: dest})
+        case "reject", "fail":
+            if strings.HasPrefix(dest, ":fail:") {
+                return nil, fmt.Errorf("SMTP-time failure needs ereject")
+            }
+            if strings.TrimSpace(dest) == "" {
+                dest = defaultRejectMessage
+            }
+            out = append(out, SOGoAction{Method: "reject", Argument: dest})
+        case "freeze":
+            folder := opts.QuarantineFolder
+            if folder == "" {
+                folder = DefaultQuarantineFolder
+            }
+            out = append(out, SOGoAction{Method: "fileinto", Argument: folder})
+        case "finish":
+            if a.Seen && !delivers(actions) {
+                out = append(out, SOGoAction{Method: "discard"})
+            }
+        default:
+            return nil, fmt.Errorf("action %q has no SOGo equivalent", a.Action)
+        }
+        // "unseen" deliveries leave the implicit keep in place; SOGo has no
+        // :copy, so keep explicitly.
+        keep = keep || a.Unseen
+    }
+    if len(out) == 0 {
+        return nil, fmt.Errorf("filter has no actions")
+    }
+    if keep {
+        out = append(out, SOGoAction{Method: "keep"})
+    }
+    return append(out, SOGoAction{Method: "stop"}), nil
+}
+
+// hasEximVars reports Exim expansions SOGo would store literally.
+func hasEximVars(s string) bool {
+    return strings.Contains(s, "$local_part") || strings.Contains(s, "$domain") || strings.Contains(s, "${")
+}
+
+// WriteSOGoFilters saves filters in the form sogo-tool user-preferences
+// set ... -f expects: {"SOGoSieveFilters": [...]}.
+func WriteSOGoFilters(path string, filters []SOGoFilter) error {
+    data, err := json.MarshalIndent(map[string][]SOGoFilter{"SOGoSieveFilters": filters}, "", "  ")
+    if err != nil {
+        return err
+    }
+    return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,55 @@
+package sieve
+
+import (
+    "strings"
+    "testing"
+)
+
+// TestConvertSOGoKeepsOrder checks that filters after the first one SOGo
+// cannot hold stay in the separate script, which runs after SOGo's.
+func TestConvertSOGoKeepsOrder(t *testing.T) {
+    rule := []Rule{{Part: "$header_subject:", Match: "contains", Val: "x"}}
+    save := []Action{{Action: "save", Dest: "$home/mail/ex.gr/chris/.X"}}
+    f := Filter{Filter: []FilterEntry{
+        {Filtername: "A", Enabled: 1, Rules: rule, Actions: save},
+        {Filtername: "Pipe", Enabled: 1, Rules: rule, Actions: []Action{{Action: "pipe", Dest: "/usr/bin/ticket"}}},
+        {Filtername: "C", Enabled: 1, Rules: rule, Actions: save},
+    }}
+    filters, rest, report := ConvertSOGo(f, DefaultOptions())
+    if len(filters) != 1 || filters[0].Name != "A" {
+        t.Errorf("SOGo filters = %+v, want A", filters)
+    }
+    if len(rest.Filter) != 2 || rest.Filter[0].Filtername != "Pipe" || rest.Filter[1].Filtername != "C" {
+        t.Errorf("rest = %+v, want Pipe, C", rest.Filter)
+    }
+    if len(report.Items) != 2 || report.Items[1].Filter != "C" || !strings.Contains(report.Items[1].Message, `after "Pipe"`) {
+        t.Errorf("report = %v", report.Items)
+    }
+}
+
+// TestConvertSOGoSpamRewrite checks that SOGo filters report the spam
+// header rewrite like the Sieve conversion, and only once it converts.
+func TestConvertSOGoSpamRewrite(t *testing.T) {
+    opts := DefaultOptions()
+    opts.SpamHeaders = map[string]SpamRewrite{"x-spam-status": {Header: "X-Spam"}}
+    rule := []Rule{{Part: "$header_X-Spam-Status:", Match: "begins", Val: "Yes"}}
+    f := Filter{Filter: []FilterEntry{
+        {Filtername: "Spam", Enabled: 1, Rules: rule, Actions: []Action{{Action: "save", Dest: "$home/mail/ex.gr/chris/.Junk"}}},
+        {Filtername: "Pipe", Enabled: 1, Rules: rule, Actions: []Action{{Action: "pipe", Dest: "/usr/bin/spam"}}},
+    }}
+    filters, _, report := ConvertSOGo(f, opts)
+    if len(filters) != 1 || filters[0].Rules[0].CustomHeader != "X-Spam" {
+        t.Fatalf("SOGo filters = %+v", filters)
+    }
+
+    _, sieveReport := ConvertFilters(Filter{Filter: f.Filter[:1]}, opts)
+    var rewrites []ReportItem
+    for _, it := range report.Items {
+        if it.Kind == ReportRewrite {
+            rewrites = append(rewrites, it)
+        }
+    }
+    if len(rewrites) != 1 || len(sieveReport.Items) != 1 || rewrites[0] != sieveReport.Items[0] {
+        t.Errorf("rewrites = %v, want %v", rewrites, sieveReport.Items)
+    }
+}
@@ -0,0 +1,114 @@
+package sieve
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+// ─────────────────────────── Spam header rewrites ──────────────────────────
+
+// SpamRewrite moves conditions on a SpamAssassin header (X-Spam-Status,
+// X-Spam-Bar, X-Spam-Score, ...) to the header the target's spam filter
+// writes, e.g. rspamd's X-Spam or X-Rspamd-Score. Thresholds of numeric
+// comparisons become Factor * score + Offset.
+type SpamRewrite struct {
+    Header string
+    Factor float64 // 0 means 1
+    Offset float64
+}
+
+// ParseSpamRewrite reads a [spam_headers] value:
+//
+//   X-Spamd-Bar
+//   X-Rspamd-Score * 1.2
+//   X-Rspamd-Score * 1.2 + 1
+//   X-Rspamd-Score - 0.5
+func ParseSpamRewrite(s string) (SpamRewrite, error) {
+    fields := strings.Fields(s)
+    if len(fields) == 0 {
+        return SpamRewrite{}, fmt.Errorf("empty target header")
+    }
+    w := SpamRewrite{Header: fields[0]}
+    if strings.ContainsAny(w.Header, ":*+") {
+        return SpamRewrite{}, fmt.Errorf("invalid header name %q", w.Header)
+    }
+    rest := fields[1:]
+    for len(rest) > 0 {
+        if len(rest) < 2 {
+            return SpamRewrite{}, fmt.Errorf("%q: expected <op> <number> after the header", s)
+        }
+        n, err := strconv.ParseFloat(rest[1], 64)
+        if err != nil {
+            return SpamRewrite{}, fmt.Errorf("%q: %q is not a number", s, rest[1])
+        }
+        switch rest[0] {
+        case "*":
+            if w.Factor != 0 || w.Offset != 0 {
+                return SpamRewrite{}, fmt.Errorf("%q: the factor goes before the offset", s)
+            }
+            w.Factor = n
+        case "+":
+            w.Offset += n
+        case "-":
+            w.Offset -= n
+        default:
+            return SpamRewrite{}, fmt.Errorf("%q: unknown operator %q (use *, + or -)", s, rest[0])
+        }
+        rest = rest[2:]
+    }
+    return w, nil
+}
+
+// scales reports whether the rewrite changes score thresholds.
+func (w SpamRewrite) scales() bool {
+    return (w.Factor != 0 && w.Factor != 1) || w.Offset != 0
+}
+
+// scale converts a score threshold; values that are not plain numbers are
+// left to the numeric conversion to report.
+func (w SpamRewrite) scale(val string) string {
+    f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+    if err != nil || !w.scales() {
+        return val
+    }
+    factor := w.Factor
+    if factor == 0 {
+        factor = 1
+    }
+    return strconv.FormatFloat(f*factor+w.Offset, 'f', -1, 64)
+}
+
+// spamRewrite looks up the rewrite of a single-header condition.
+func spamRewrite(field fieldInfo, opts Options) (SpamRewrite, bool) {
+    if field.kind != fieldHeader || field.addressPart != "" || len(field.headers) != 1 {
+        return SpamRewrite{}, false
+    }
+    w, ok := opts.SpamHeaders[strings.ToLower(field.headers[0])]
+    return w, ok
+}
+
+// rewriteSpam applies opts.SpamHeaders to a header condition. It returns
+// the field and value to test, and notes the rewrite in the report and in
+// the comments above the rule.
+func (c *converter) rewriteSpam(r *Rule, field fieldInfo, val string, numeric bool) (fieldInfo, string) {
+    w, ok := spamRewrite(field, c.opts)
+    if !ok {
+        return field, val
+    }
+
+    from := field.headers[0]
+    field.headers = []string{w.Header}
+    match := strings.TrimSpace(r.Match)
+    note := fmt.Sprintf("spam_headers: %s is tested on %s", from, w.Header)
+    if numeric && w.scales() {
+        if scaled := w.scale(val); scaled != val {
+            note = fmt.Sprintf("spam_headers: %s %s %s becomes %s %s %s",
+                from, match, strings.TrimSpace(val), w.Header, match, scaled)
+            val = scaled
+        }
+    }
+    c.notes = append(c.notes, note)
+    c.report.add(c.filter, ReportRewrite, "", "%s: %s", ruleText(r), strings.TrimPrefix(note, "spam_headers: "))
+    return field, val
+}
@@ -5,11 +5,16 @@ type Rule struct {
     Match string `yaml:"match"`
     Val   string `yaml:"val"`
     Opt   string `yaml:"opt"`
+
+    // CaseSensitive is set for Exim's capitalised verbs (Contains, Is, ...).
+    CaseSensitive bool `yaml:"casesensitive,omitempty"`
 }
 
 type Action struct {
     Action string `yaml:"action"`
     Dest   string `yaml:"dest"`
+    Unseen bool   `yaml:"unseen,omitempty"` // Exim "unseen": keep delivering normally too
+    Seen   bool   `yaml:"seen,omitempty"`   // Exim "seen": counts as the final delivery
 }
 
 type FilterEntry struct {
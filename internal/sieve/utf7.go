@@ -0,0 +1,68 @@
+package sieve
+
+import (
+    "encoding/base64"
+    "fmt"
+    "strings"
+    "unicode/utf16"
+    "unicode/utf8"
+)
+
+// modifiedBase64 is the base64 variant of IMAP mailbox names: "," instead
+// of "/" and no padding (RFC 3501 §5.1.3).
+var modifiedBase64 = base64.NewEncoding(
+    "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+,",
+).WithPadding(base64.NoPadding)
+
+// DecodeModifiedUTF7 decodes an IMAP modified UTF-7 mailbox name, as
+// Dovecot and Courier store them on disk, into UTF-8:
+//
+//   &A5MDsQPBA7cDwQ-   ->   Γαρηρ
+//   R&-D                ->   R&D
+//
+// Names without "&" are returned unchanged.
+func DecodeModifiedUTF7(s string) (string, error) {
+    if !strings.Contains(s, "&") {
+        return s, nil
+    }
+
+    var b strings.Builder
+    for i := 0; i < len(s); {
+        c := s[i]
+        if c < 0x20 || c > 0x7e {
+            return "", fmt.Errorf("invalid byte %#x in modified UTF-7 name %q", c, s)
+        }
+        if c != '&' {
+            b.WriteByte(c)
+            i++
+            continue
+        }
+
+        end := strings.IndexByte(s[i+1:], '-')
+        if end < 0 {
+            return "", fmt.Errorf("unterminated &...- sequence in %q", s)
+        }
+        chunk := s[i+1 : i+1+end]
+        i += end + 2
+        if chunk == "" {
+            b.WriteByte('&')
+            continue
+        }
+
+        raw, err := modifiedBase64.DecodeString(chunk)
+        if err != nil || len(raw)%2 != 0 {
+            return "", fmt.Errorf("invalid base64 %q in modified UTF-7 name %q", chunk, s)
+        }
+        units := make([]uint16, len(raw)/2)
+        for j := range units {
+            units[j] = uint16(raw[2*j])<<8 | uint16(raw[2*j+1])
+        }
+        for _, r := range utf16.Decode(units) {
+            if r == utf8.RuneError {
+                return "", fmt.Errorf("invalid UTF-16 in modified UTF-7 name %q", s)
+            }
+            b.WriteRune(r)
+        }
+    }
+    return b.String(), nil
+}
@@ -0,0 +1,39 @@
+package sieve
+
+import (
+    "testing"
+)
+
+func TestDecodeModifiedUTF7(t *testing.T) {
+    tests := []struct {
+        in, want string
+    }{
+        {"Archive", "Archive"},
+        {"&A5MDsQPBA7cDwQ-", "Γαρηρ"},
+        {"&-", "&"},
+        {"R&-D", "R&D"},
+        {"Work.&AOk-t&AOk-", "Work.été"},
+        {"&2D3eAA-", "😀"},
+    }
+    for _, tt := range tests {
+        got, err := DecodeModifiedUTF7(tt.in)
+        if err != nil || got != tt.want {
+            t.Errorf("DecodeModifiedUTF7(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+        }
+    }
+
+    bad := []string{
+        "&A5M!-",   // not modified base64
+        "&A5M/A-",  // "/" is "," in modified base64
+        "&AO-",     // odd number of bytes
+        "&2D0-",    // lone surrogate
+        "&A5MDsQ",  // no closing "-"
+        "Trash&",   // trailing "&"
+        "été&-",    // 8-bit name
+    }
+    for _, in := range bad {
+        if got, err := DecodeModifiedUTF7(in); err == nil {
+            t.Errorf("DecodeModifiedUTF7(%q) = %q, want an error", in, got)
+        }
+    }
+}
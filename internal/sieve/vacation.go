@@ -0,0 +1,168 @@
+package sieve
+
+import (
+    "fmt"
+    "strings"
+    "time"
+    "unicode/utf8"
+)
+
+// Vacation is an autoresponder in a neutral form (cPanel ~/.autorespond).
+type Vacation struct {
+    Addresses []string // the mailbox's own addresses (:addresses)
+    From      string   // From header of the reply, empty = the recipient
+    Subject   string   // may contain cPanel's %subject% placeholder
+    Body      string
+    Charset   string // charset of the original message; Body is already UTF-8
+    HTML      bool
+    Interval  time.Duration // minimum time between replies to one sender
+    Start     time.Time     // zero = active immediately
+    Stop      time.Time     // zero = no end
+}
+
+// vacationDateLayout is compared against currentdate "iso8601" in UTC.
+// The zone suffix is left out on purpose: as a prefix, the value orders
+// correctly against "...+00:00" and "...Z" alike.
+const vacationDateLayout = "2006-01-02T15:04:05"
+
+// ConvertVacation builds the vacation script of a mailbox. The script is
+// meant to go first in the combined script so filters that stop do not
+// suppress the reply.
+func ConvertVacation(name string, v Vacation, opts Options) (SieveScript, *Report) {
+    if opts.Profile.Extensions == nil {
+        opts.Profile = DefaultOptions().Profile
+    }
+    report := &Report{Profile: opts.Profile.Name}
+    c := &converter{opts: opts, report: report, filter: name, used: map[string]bool{}}
+    return NewSieveScript(name, c.vacation(v)), report
+}
+
+func (c *converter) vacation(v Vacation) *Script {
+    script := &Script{}
+    if !c.opts.Profile.Has("vacation") {
+        c.report.add(c.filter, ReportBlocking, "vacation", "autoresponder cannot be migrated: the target has no vacation extension")
+        script.Commands = append(script.Commands, CommentBlock("TODO: autoresponder not migrated (vacation not available)"))
+        return script
+    }
+    c.used["vacation"] = true
+
+    var args []Arg
+    args = append(args, c.vacationPeriod(v.Interval)...)
+
+    var prelude *Command
+    if subject := strings.TrimSpace(v.Subject); subject != "" {
+        if strings.Contains(subject, "%subject%") {
+            if c.opts.Profile.Has("variables") {
+                c.used["variables"] = true
+                subject = strings.ReplaceAll(subject, "%subject%", "${subject}")
+                prelude = &Command{
+                    Name: "if",
+                    Test: NewTest("header", Tag("matches"), String("Subject"), String("*")),
+                    Block: []*Command{
+                        NewCommand("set", String("subject"), String("${1}")),
+                    },
+                }
+            } else {
+                c.degrade("variables", "%%subject%% in the autoresponder subject is kept literally")
+            }
+        }
+        if strings.Contains(subject, "%") {
+            c.report.add(c.filter, ReportDegraded, "", "cPanel placeholders in subject %q are not expanded", subject)
+        }
+        args = append(args, Tag("subject"), String(subject))
+    }
+    if v.From != "" {
+        args = append(args, Tag("from"), String(v.From))
+    }
+    if len(v.Addresses) > 0 {
+        args = append(args, Tag("addresses"), StringList(v.Addresses))
+    }
+
+    body := v.Body
+    if v.HTML || !isASCII(body) {
+        // :mime takes a whole MIME entity, which is the only way to state
+        // the content type and charset of the reply.
+        ctype := "text/plain"
+        if v.HTML {
+            ctype = "text/html"
+        }
+        // Sieve scripts are UTF-8, so the reply is too, whatever the
+        // autoresponder was stored in.
+        if !utf8.ValidString(body) {
+            c.report.add(c.filter, ReportBlocking, "", "autoresponder body in charset %q could not be converted to UTF-8", v.Charset)
+            body = strings.ToValidUTF8(body, "?")
+        }
+        args = append(args, Tag("mime"))
+        body = fmt.Sprintf("Content-Type: %s; charset=utf-8\nContent-Transfer-Encoding: 8bit\n\n%s", ctype, body)
+    }
+    args = append(args, String(body))
+
+    vac := NewCommand("vacation", args...)
+    vac.Comments = []string{"cPanel autoresponder"}
+
+    var guards []*Test
+    if !v.Start.IsZero() || !v.Stop.IsZero() {
+        if !c.opts.Profile.Has("date") || !c.opts.Profile.Has("relational") {
+            c.degrade("date", "autoresponder start/stop times cannot be enforced; it is always active")
+        } else {
+            c.used["date"] = true
+            c.used["relational"] = true
+            if !v.Start.IsZero() {
+                guards = append(guards, currentDate("ge", v.Start))
+            }
+            if !v.Stop.IsZero() {
+                guards = append(guards, currentDate("le", v.Stop))
+            }
+        }
+    }
+
+    script.Commands = append(script.Commands, requireCommand(c.used))
+    if prelude != nil {
+        script.Commands = append(script.Commands, prelude)
+    }
+    switch len(guards) {
+    case 0:
+        script.Commands = append(script.Commands, vac)
+    case 1:
+        script.Commands = append(script.Commands, &Command{Name: "if", Test: guards[0], Block: []*Command{vac}})
+    default:
+        script.Commands = append(script.Commands, &Command{Name: "if", Test: &Test{Name: "allof", Tests: guards}, Block: []*Command{vac}})
+    }
+    return script
+}
+
+// vacationPeriod converts the cPanel reply interval. Whole days use :days;
+// anything else needs vacation-seconds or is rounded up to days.
+func (c *converter) vacationPeriod(d time.Duration) []Arg {
+    if d > 0 && d%(24*time.Hour) == 0 {
+        return []Arg{Tag("days"), Number{Value: uint64(d / (24 * time.Hour))}}
+    }
+    if c.opts.Profile.Has("vacation-seconds") {
+        c.used["vacation-seconds"] = true
+        return []Arg{Tag("seconds"), Number{Value: uint64(d / time.Second)}}
+    }
+    days := uint64((d + 24*time.Hour - 1) / (24 * time.Hour))
+    if days == 0 {
+        days = 1
+    }
+    c.degrade("vacation-seconds", "reply interval %s rounded up to %d day(s)", d, days)
+    return []Arg{Tag("days"), Number{Value: days}}
+}
+
+// currentDate compares the current UTC time against t.
+func currentDate(rel string, t time.Time) *Test {
+    return NewTest("currentdate",
+        Tag("zone"), String("+0000"),
+        Tag("value"), String(rel),
+        String("iso8601"), String(t.UTC().Format(vacationDateLayout)),
+    )
+}
+
+func isASCII(s string) bool {
+    for i := 0; i < len(s); i++ {
+        if s[i] >= 0x80 {
+            return false
+        }
+    }
+    return true
+}
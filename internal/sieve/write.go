@@ -5,6 +5,7 @@ import (
     "io/ioutil"
     "os"
     "path/filepath"
+    "strings"
 )
 
 func WriteScripts(scripts []SieveScript, dest string) error {
@@ -20,3 +21,21 @@ func WriteScripts(scripts []SieveScript, dest string) error {
     }
     return nil
 }
+
+// ReadScript loads and parses a .sieve file. The script is named after the
+// file without its extension; syntax errors carry the file name.
+func ReadScript(path string) (SieveScript, error) {
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        return SieveScript{}, err
+    }
+    tree, err := ParseScript(string(data))
+    if err != nil {
+        return SieveScript{}, fmt.Errorf("%s: %w", path, err)
+    }
+    return SieveScript{
+        Name:    strings.TrimSuffix(filepath.Base(path), ".sieve"),
+        Content: string(data),
+        Script:  tree,
+    }, nil
+}